@@ -0,0 +1,230 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+func attrPath(index string, frame string) string {
+	path := "/index/" + url.PathEscape(index)
+	if frame != "" {
+		path += "/frame/" + url.PathEscape(frame)
+	}
+	return path + "/attr"
+}
+
+func (c *Client) recalculateCaches() error {
+	_, err := c.httpRequest("POST", "/recalculate-caches", []byte{})
+	return err
+}
+
+func (c *Client) restoreFrame(index string, frame string, host string) error {
+	query := url.Values{}
+	query.Set("host", host)
+	path := fmt.Sprintf("/index/%s/frame/%s/restore?%s", url.PathEscape(index), url.PathEscape(frame), query.Encode())
+	_, err := c.httpRequest("POST", path, []byte{})
+	return err
+}
+
+func (c *Client) attrBlocks(index string, frame string) ([]*checksumBlock, error) {
+	response, err := c.httpGet(attrPath(index, frame) + "/blocks")
+	if err != nil {
+		return nil, err
+	}
+	blocks := struct {
+		Blocks []*checksumBlock `json:"blocks"`
+	}{}
+	err = json.Unmarshal(response.Body, &blocks)
+	if err != nil {
+		return nil, err
+	}
+	return blocks.Blocks, nil
+}
+
+// attrDiff sends the given attribute blocks to the server, which returns
+// the attributes in the blocks which differ from its own.
+func (c *Client) attrDiff(index string, frame string, blocks []*checksumBlock) (map[string]map[string]interface{}, error) {
+	data, err := json.Marshal(map[string]interface{}{"blocks": blocks})
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.httpRequest("POST", attrPath(index, frame)+"/diff", data)
+	if err != nil {
+		return nil, err
+	}
+	diff := struct {
+		Attrs map[string]map[string]interface{} `json:"attrs"`
+	}{}
+	err = json.Unmarshal(response.Body, &diff)
+	if err != nil {
+		return nil, err
+	}
+	return diff.Attrs, nil
+}
+
+func (c *Console) executeAdminCommand(cmd string, args []string) error {
+	if c.conn == nil {
+		return errNotConnected
+	}
+	if len(args) < 1 {
+		return errors.New("usage: :admin {recalculate-caches | restore-frame | attr-diff} [args]")
+	}
+	switch args[0] {
+	case "recalculate-caches":
+		return c.executeRecalculateCaches(args[1:])
+	case "restore-frame":
+		return c.executeRestoreFrame(args[1:])
+	case "attr-diff":
+		return c.executeAttrDiff(args[1:])
+	}
+	return fmt.Errorf("Invalid admin command: %s", args[0])
+}
+
+func (c *Console) executeRecalculateCaches(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: :admin recalculate-caches")
+	}
+	ok, err := c.confirm(fmt.Sprintf("Recalculate all caches on %s?", c.conn.address()))
+	if !ok {
+		return err
+	}
+	return runAdminTask(fmt.Sprintf("Recalculating caches on %s", c.conn.address()),
+		c.conn.httpClient.recalculateCaches)
+}
+
+func (c *Console) executeRestoreFrame(args []string) error {
+	if len(args) != 3 {
+		return errors.New("usage: :admin restore-frame index-name frame-name source-host")
+	}
+	index, frame, host := args[0], args[1], args[2]
+	ok, err := c.confirm(fmt.Sprintf("Restore frame %s of index %s on %s from %s? Existing data of the frame will be overwritten.",
+		frame, index, c.conn.address(), host))
+	if !ok {
+		return err
+	}
+	return runAdminTask(fmt.Sprintf("Restoring frame %s of index %s from %s", frame, index, host),
+		func() error {
+			return c.conn.httpClient.restoreFrame(index, frame, host)
+		})
+}
+
+func (c *Console) executeAttrDiff(args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("usage: :admin attr-diff connection-name index-name [frame-name]")
+	}
+	other, ok := c.connections[args[0]]
+	if !ok {
+		return fmt.Errorf("Unknown connection: %s", args[0])
+	}
+	index := args[1]
+	frame := ""
+	if len(args) == 3 {
+		frame = args[2]
+	}
+	blocks, err := c.conn.httpClient.attrBlocks(index, frame)
+	if err != nil {
+		return err
+	}
+	attrs, err := other.httpClient.attrDiff(index, frame, blocks)
+	if err != nil {
+		return err
+	}
+	if len(attrs) == 0 {
+		fmt.Fprintln(c.stdout, colorString(fgGreen, fmt.Sprintf("Attributes on %s and %s are the same", c.conn.name, other.name)))
+		return nil
+	}
+	ids := make([]string, 0, len(attrs))
+	for id := range attrs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.ParseUint(ids[i], 10, 64)
+		b, _ := strconv.ParseUint(ids[j], 10, 64)
+		return a < b
+	})
+	fmt.Fprintf(c.stdout, "Attributes on %s which differ from %s:\n", other.name, c.conn.name)
+	for _, id := range ids {
+		data, _ := json.Marshal(attrs[id])
+		fmt.Fprintf(c.stdout, "    %s: %s\n", id, data)
+	}
+	printWarning(fmt.Sprintf("%d attribute sets differ", len(attrs)))
+	return nil
+}
+
+// confirm asks the user a yes/no question, defaulting to no. The answer is not saved to the history.
+// It fails if there is no terminal to ask on, e.g. when the output of the command is piped.
+func (c *Console) confirm(question string) (bool, error) {
+	if c.terminalReleased || !readline.IsTerminal(int(os.Stdin.Fd())) {
+		return false, errors.New("Confirmation requires a terminal, the command was not run")
+	}
+	defer c.updatePrompt()
+	c.inst.HistoryDisable()
+	defer c.inst.HistoryEnable()
+	c.setPrompt(colorString(fgYellow, question)+" [y/N] ", nil)
+	answer, err := c.inst.Readline()
+	if err != nil {
+		return false, errors.New("Cancelled")
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "y" || answer == "yes" {
+		return true, nil
+	}
+	fmt.Println("Cancelled")
+	return false, nil
+}
+
+func runAdminTask(description string, task func() error) error {
+	fmt.Printf("%s...", description)
+	tic := time.Now()
+	err := task()
+	elapsed := time.Since(tic)
+	fmt.Println()
+	if err != nil {
+		return fmt.Errorf("%s failed after %s: %s", description, elapsed, err)
+	}
+	fmt.Println(colorString(fgGreen, fmt.Sprintf("%s succeeded in %s", description, elapsed)))
+	return nil
+}
@@ -37,13 +37,24 @@ package picon
 type Ansi string
 
 const (
-	fgBlack   Ansi = "\033[0;30m"
-	fgRed     Ansi = "\033[0;31m"
-	fgGreen   Ansi = "\033[0;32m"
-	fgYellow  Ansi = "\033[0;33m"
-	fgBlue    Ansi = "\033[0;34m"
-	fgMagenta Ansi = "\033[0;35m"
-	fgCyan    Ansi = "\033[0;36m"
-	fgWhite   Ansi = "\033[0;37m"
-	attrReset Ansi = "\033[0m"
+	fgBlack     Ansi = "\033[0;30m"
+	fgRed       Ansi = "\033[0;31m"
+	fgGreen     Ansi = "\033[0;32m"
+	fgYellow    Ansi = "\033[0;33m"
+	fgBlue      Ansi = "\033[0;34m"
+	fgMagenta   Ansi = "\033[0;35m"
+	fgCyan      Ansi = "\033[0;36m"
+	fgWhite     Ansi = "\033[0;37m"
+	attrReset   Ansi = "\033[0m"
+	attrBold    Ansi = "\033[1m"
+	attrDim     Ansi = "\033[2m"
+	attrReverse Ansi = "\033[7m"
+)
+
+const (
+	clearScreen    = "\033[H\033[2J"
+	hideCursor     = "\033[?25l"
+	showCursor     = "\033[?25h"
+	enterAltScreen = "\033[?1049h"
+	leaveAltScreen = "\033[?1049l"
 )
@@ -36,12 +36,17 @@ package picon
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	pilosa "github.com/pilosa/go-pilosa"
@@ -50,15 +55,48 @@ import (
 const ConnectTimeout = 10 * time.Second
 const SocketTimeout = 100 * time.Second
 
+// IdleConnTimeout is how long an unused connection is kept in the pool.
+const IdleConnTimeout = 90 * time.Second
+
+// gzipRequestThreshold is the minimum size of a query to compress it when compression is enabled.
+const gzipRequestThreshold = 64 * 1024
+
 type Client struct {
 	URI        *pilosa.URI
 	httpClient *http.Client
+	// gzipUnsupported is set when the server rejects a compressed request, it is guarded by mu.
+	gzipUnsupported bool
+	mu              sync.Mutex
 }
 
 type HttpResponse struct {
 	Body       []byte
 	Type       string
 	StatusCode int
+	status     string
+	// WireSize is the size of the body as received, before decompression.
+	WireSize   int
+	compressed bool
+	// decoded is the query response decoded from a protobuf body, see decode.
+	decoded *queryResponse
+}
+
+type queryTransport int
+
+const (
+	transportJSON queryTransport = iota
+	transportProtobuf
+)
+
+const protobufContentType = "application/x-protobuf"
+
+type queryOptions struct {
+	transport   queryTransport
+	columnAttrs bool
+	// slices restricts the query to the given slices, all slices are queried if it is empty.
+	slices []uint64
+	// gzip enables compressing large queries.
+	gzip bool
 }
 
 func NewClient(addr string) (*Client, error) {
@@ -72,13 +110,118 @@ func NewClient(addr string) (*Client, error) {
 	}, nil
 }
 
-func (c *Client) query(index string, text string) ([]byte, error) {
+// forHost returns a client for another host, which shares the HTTP client
+// and so the connection pool and the tracing of c.
+func (c *Client) forHost(addr string) (*Client, error) {
+	uri, err := pilosa.NewURIFromAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		URI:        uri,
+		httpClient: c.httpClient,
+	}, nil
+}
+
+// query runs a PQL query. Protobuf responses are returned decoded, see HttpResponse.decode.
+func (c *Client) query(index string, text string, options *queryOptions) (*HttpResponse, error) {
 	path := "/index/" + index + "/query"
-	response, err := c.httpRequest("POST", path, []byte(text))
+	if options.transport == transportProtobuf {
+		return c.queryProtobuf(path, text, options)
+	}
+	params := url.Values{}
+	if options.columnAttrs {
+		params.Set("columnAttrs", "true")
+	}
+	if len(options.slices) > 0 {
+		params.Set("slices", joinSlices(options.slices))
+	}
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	response, err := c.postQuery(path, []byte(text), http.Header{}, options)
 	if err != nil {
 		return nil, err
 	}
-	return response.Body, nil
+	if !response.succeeded() {
+		return nil, fmt.Errorf("%s: %s", response.status, response.Body)
+	}
+	return response, nil
+}
+
+func (c *Client) queryProtobuf(path string, text string, options *queryOptions) (*HttpResponse, error) {
+	request := &pbQueryRequest{
+		query:       text,
+		slices:      options.slices,
+		columnAttrs: options.columnAttrs,
+	}
+	header := http.Header{}
+	header.Set("Content-Type", protobufContentType)
+	header.Set("Accept", protobufContentType)
+	response, err := c.postQuery(path, request.marshal(), header, options)
+	if err != nil {
+		return nil, err
+	}
+	pbResponse, err := unmarshalQueryResponse(response.Body)
+	if err == nil && pbResponse.err != "" {
+		return nil, fmt.Errorf("%s: %s", response.status, pbResponse.err)
+	}
+	if err != nil || !response.succeeded() {
+		// the server may respond with text if the request could not be decoded
+		return nil, fmt.Errorf("%s: %s", response.status, response.Body)
+	}
+	response.decoded = pbResponse.queryResponse(topLevelCalls(text))
+	return response, nil
+}
+
+// postQuery sends a query and reads the response, see sendQuery.
+func (c *Client) postQuery(path string, data []byte, header http.Header, options *queryOptions) (*HttpResponse, error) {
+	response, err := c.sendQuery(path, data, header, options)
+	if err != nil {
+		return nil, err
+	}
+	return readResponse(response)
+}
+
+// sendQuery compresses large queries if enabled. If the server rejects the compressed query
+// with 415 Unsupported Media Type, it is sent again uncompressed and compression is not used
+// for this client anymore. Other errors, e.g. 400 for an invalid query, are returned as they are.
+// The caller must close the body of the response.
+func (c *Client) sendQuery(path string, data []byte, header http.Header, options *queryOptions) (*http.Response, error) {
+	if !options.gzip || c.compressionDisabled() || len(data) < gzipRequestThreshold {
+		return c.send("POST", path, data, header)
+	}
+	compressed, err := gzipBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	gzipHeader := http.Header{}
+	for key, values := range header {
+		gzipHeader[key] = values
+	}
+	gzipHeader.Set("Content-Encoding", "gzip")
+	response, err := c.send("POST", path, compressed, gzipHeader)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusUnsupportedMediaType {
+		response.Body.Close()
+		c.disableCompression()
+		return c.send("POST", path, data, header)
+	}
+	return response, nil
+}
+
+func (c *Client) compressionDisabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gzipUnsupported
+}
+
+func (c *Client) disableCompression() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gzipUnsupported = true
 }
 
 func (c *Client) serverVersion() (string, error) {
@@ -100,38 +243,127 @@ func (c *Client) httpGet(path string) (*HttpResponse, error) {
 }
 
 func (c *Client) httpRequest(method string, path string, data []byte) (*HttpResponse, error) {
-	path = c.URI.Normalize() + path
-	request, err := http.NewRequest(method, path, bytes.NewReader(data))
+	response, err := c.doRequest(method, path, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !response.succeeded() {
+		return nil, fmt.Errorf("%s: %s", response.status, response.Body)
+	}
+	return response, nil
+}
+
+// doRequest sends an HTTP request and returns the response even if the status is not successful.
+func (c *Client) doRequest(method string, path string, data []byte, header http.Header) (*HttpResponse, error) {
+	response, err := c.send(method, path, data, header)
 	if err != nil {
 		return nil, err
 	}
-	response, err := c.httpClient.Do(request)
+	return readResponse(response)
+}
+
+// send sends an HTTP request, the caller must close the body of the response.
+func (c *Client) send(method string, path string, data []byte, header http.Header) (*http.Response, error) {
+	path = c.URI.Normalize() + path
+	request, err := http.NewRequest(method, path, bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	// setting Accept-Encoding disables the transparent decompression of the transport,
+	// so the size of the compressed response is known
+	request.Header.Set("Accept-Encoding", "gzip")
+	return c.httpClient.Do(request)
+}
+
+// readResponse reads and closes the body of the response.
+func readResponse(response *http.Response) (*HttpResponse, error) {
 	defer response.Body.Close()
 	buf, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		return nil, fmt.Errorf("%s: %s", response.Status, buf)
+	wireSize := len(buf)
+	compressed := response.Header.Get("Content-Encoding") == "gzip"
+	if compressed {
+		buf, err = gunzipBytes(buf)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &HttpResponse{
 		Body:       buf,
 		Type:       response.Header.Get("content-type"),
 		StatusCode: response.StatusCode,
+		status:     response.Status,
+		WireSize:   wireSize,
+		compressed: compressed,
 	}, nil
 }
 
+// close closes the idle connections of the client.
+func (c *Client) close() {
+	if transport, ok := c.httpClient.Transport.(interface {
+		CloseIdleConnections()
+	}); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+// decode returns the decoded query response, the body is decoded unless it was received as protobuf.
+func (r *HttpResponse) decode(query string) *decodedResponse {
+	if r.decoded != nil {
+		return &decodedResponse{query: query, decoded: r.decoded}
+	}
+	return newDecodedResponse(r.Body, query)
+}
+
+func (r *HttpResponse) succeeded() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
 func newHTTPClient() *http.Client {
 	transport := &http.Transport{
 		Dial: (&net.Dialer{
 			Timeout: ConnectTimeout,
 		}).Dial,
+		IdleConnTimeout: IdleConnTimeout,
 	}
 	return &http.Client{
 		Transport: transport,
 		Timeout:   SocketTimeout,
 	}
 }
+
+func gzipBytes(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	_, err := writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+func joinSlices(slices []uint64) string {
+	parts := make([]string, len(slices))
+	for i, slice := range slices {
+		parts[i] = strconv.FormatUint(slice, 10)
+	}
+	return strings.Join(parts, ",")
+}
@@ -35,6 +35,7 @@ DAMAGE.
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/user"
@@ -47,6 +48,8 @@ const Version = "0.2.0"
 
 func main() {
 	var err error
+	format := flag.String("format", "json", "output format: json, compact, table, csv, yaml or raw")
+	flag.Parse()
 	defaultHomeDir := ""
 	usr, err := user.Current()
 	if err == nil {
@@ -57,6 +60,11 @@ func main() {
 		fmt.Println("ERROR: ", err)
 		os.Exit(1)
 	}
+	err = console.SetFormat(*format)
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+		os.Exit(1)
+	}
 	fmt.Printf(`       _ 
  _ __ (_) ___ ___  _ __  
 | '_ \| |/ __/ _ \| '_ \ 
@@ -0,0 +1,249 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const compareColumnSeparator = " | "
+
+type compareResult struct {
+	conn     *connection
+	response *decodedResponse
+	err      error
+	elapsed  time.Duration
+}
+
+func (c *Console) executeCompareCommand(cmd string, args []string, line string) error {
+	if len(args) < 2 {
+		return errors.New("usage: :compare connection1,connection2[,...] query")
+	}
+	if c.index == nil {
+		return errNoIndex
+	}
+	names := strings.Split(args[0], ",")
+	if len(names) < 2 {
+		return errors.New("At least two connections are required to compare")
+	}
+	conns := make([]*connection, 0, len(names))
+	for _, name := range names {
+		conn, ok := c.connections[name]
+		if !ok {
+			return fmt.Errorf("Unknown connection: %s", name)
+		}
+		conns = append(conns, conn)
+	}
+	// the query is taken as is from the line, so spaces in quoted arguments are kept
+	query := lineAfterFields(line, 2)
+	results := compareQuery(conns, c.index.Name(), query, c.queryOptions)
+	printCompareResults(c.stdout, results, c.bitLimit)
+	return nil
+}
+
+// compareQuery sends the query to all connections concurrently.
+func compareQuery(conns []*connection, index string, query string, options *queryOptions) []*compareResult {
+	results := make([]*compareResult, len(conns))
+	wg := &sync.WaitGroup{}
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *connection) {
+			defer wg.Done()
+			tic := time.Now()
+			response, err := conn.httpClient.query(index, query, options)
+			result := &compareResult{
+				conn:    conn,
+				err:     err,
+				elapsed: time.Since(tic),
+			}
+			if err == nil {
+				result.response = response.decode(query)
+			}
+			results[i] = result
+		}(i, conn)
+	}
+	wg.Wait()
+	return results
+}
+
+// printCompareResults displays the responses side by side, highlighting the lines which differ.
+// Each result starts on the same line in all columns, so a difference does not shift the following results.
+// The differences of the decoded results of each connection from the first one follow.
+func printCompareResults(w io.Writer, results []*compareResult, bitLimit int) {
+	columns := make([][][]string, len(results))
+	blockCount := 0
+	for i, result := range results {
+		columns[i] = compareResultBlocks(result, bitLimit)
+		if len(columns[i]) > blockCount {
+			blockCount = len(columns[i])
+		}
+	}
+	width := (screenWidth() - len(compareColumnSeparator)*(len(results)-1)) / len(results)
+	if width < 10 {
+		width = 10
+	}
+
+	headers := make([]string, len(results))
+	for i, result := range results {
+		headers[i] = padColumn(fmt.Sprintf("%s (%s)", result.conn.name, result.elapsed), width)
+	}
+	fmt.Fprintln(w, colorString(fgCyan, strings.Join(headers, compareColumnSeparator)))
+
+	for block := 0; block < blockCount; block++ {
+		height := 0
+		for _, column := range columns {
+			if block < len(column) && len(column[block]) > height {
+				height = len(column[block])
+			}
+		}
+		for row := 0; row < height; row++ {
+			cells := make([]string, len(columns))
+			same := true
+			for i, column := range columns {
+				if block < len(column) && row < len(column[block]) {
+					cells[i] = column[block][row]
+				}
+				if cells[i] != cells[0] {
+					same = false
+				}
+			}
+			for i := range cells {
+				cells[i] = padColumn(cells[i], width)
+				if !same {
+					cells[i] = colorString(fgRed, cells[i])
+				}
+			}
+			fmt.Fprintln(w, strings.Join(cells, compareColumnSeparator))
+		}
+	}
+
+	if resultsEqual(results) {
+		fmt.Fprintln(w, colorString(fgGreen, "Results are identical"))
+		return
+	}
+	fmt.Fprintln(w, colorString(fgRed, "Results differ"))
+	first := results[0]
+	if first.err != nil || first.response.decoded == nil {
+		return
+	}
+	for _, result := range results[1:] {
+		if result.err != nil || result.response.decoded == nil {
+			continue
+		}
+		fmt.Fprintln(w, colorString(attrBold, fmt.Sprintf("Diff A=%s B=%s", first.conn.name, result.conn.name)))
+		fmt.Fprint(w, renderDiff(first.response.decoded, result.response.decoded, bitLimit))
+	}
+}
+
+// compareResultBlocks renders a response as indented JSON lines, with a block for each result
+// and one for the column attributes. Bitmaps with more bits than bitLimit are truncated.
+func compareResultBlocks(result *compareResult, bitLimit int) [][]string {
+	if result.err != nil {
+		return [][]string{strings.Split(result.err.Error(), "\n")}
+	}
+	truncated, summaries := truncateBitmaps(result.response, bitLimit)
+	response := truncated.decoded
+	if response == nil {
+		return [][]string{indentLines(result.response.jsonBody())}
+	}
+	summarized := map[int]bitmapSummary{}
+	for _, summary := range summaries {
+		summarized[summary.result] = summary
+	}
+	blocks := [][]string{}
+	for i, r := range response.results {
+		title := r.call
+		if title == "" {
+			title = fmt.Sprintf("Result %d", i)
+		}
+		lines := append([]string{title}, indentValue(r.jsonValue())...)
+		if summary, ok := summarized[i]; ok {
+			lines = append(lines, fmt.Sprintf("… %s more bits", formatThousands(uint64(summary.count-summary.displayed))))
+		}
+		blocks = append(blocks, lines)
+	}
+	if len(response.columnAttrs) > 0 {
+		blocks = append(blocks, append([]string{"Column attributes"}, indentValue(response.columnAttrs)...))
+	}
+	return blocks
+}
+
+func indentValue(value interface{}) []string {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return strings.Split(string(data), "\n")
+}
+
+func indentLines(body []byte) []string {
+	buf := &bytes.Buffer{}
+	if err := json.Indent(buf, body, "", "  "); err != nil {
+		return strings.Split(string(body), "\n")
+	}
+	return strings.Split(buf.String(), "\n")
+}
+
+// resultsEqual compares the decoded responses, so formatting differences are ignored.
+func resultsEqual(results []*compareResult) bool {
+	var first *queryResponse
+	for i, result := range results {
+		if result.err != nil || result.response.decoded == nil {
+			return false
+		}
+		decoded := result.response.decoded
+		if i == 0 {
+			first = decoded
+		} else if !first.equal(decoded) {
+			return false
+		}
+	}
+	return true
+}
+
+func padColumn(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
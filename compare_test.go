@@ -0,0 +1,84 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintCompareResults(t *testing.T) {
+	query := "Bitmap(frame=f, rowID=1) Count(Bitmap(frame=f, rowID=2))"
+	results := []*compareResult{
+		{conn: &connection{name: "a"}, response: newDecodedResponse([]byte(`{"results":[{"attrs":{},"bits":[1,2,3,4,5]},7]}`), query)},
+		{conn: &connection{name: "b"}, response: newDecodedResponse([]byte(`{"results":[{"attrs":{},"bits":[1,2,3,4,5,6]},7]}`), query)},
+	}
+	buf := &bytes.Buffer{}
+	printCompareResults(buf, results, 3)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	highlighted := func(text string) bool {
+		for _, line := range lines {
+			if strings.Contains(line, text) {
+				return strings.HasPrefix(line, string(fgRed))
+			}
+		}
+		t.Fatalf("%q is not in the output:\n%s", text, buf.String())
+		return false
+	}
+	// the bits are truncated to the bit limit, so only the counts of the remaining bits differ
+	if strings.Contains(buf.String(), "4,") || highlighted(`"bits": [`) {
+		t.Errorf("the bits should be truncated and the same:\n%s", buf.String())
+	}
+	if !highlighted("… 2 more bits") {
+		t.Errorf("the number of remaining bits should be highlighted:\n%s", buf.String())
+	}
+	// the results after the bitmap are aligned and not highlighted
+	if highlighted("Count") || highlighted("7") {
+		t.Errorf("the count should not be highlighted:\n%s", buf.String())
+	}
+	// the verdict is followed by the diff of the decoded results, which are not truncated
+	verdict := strings.Index(buf.String(), colorString(fgRed, "Results differ")+"\n"+
+		colorString(attrBold, "Diff A=a B=b")+"\n")
+	if verdict < 0 || !strings.Contains(buf.String()[verdict:], "Only in B: "+colorString(fgGreen, "1 bit: 6")) {
+		t.Errorf("the difference should be written to the output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	printCompareResults(buf, []*compareResult{results[0], results[0]}, 0)
+	if !strings.HasSuffix(buf.String(), colorString(fgGreen, "Results are identical")+"\n") {
+		t.Errorf("expected identical results:\n%s", buf.String())
+	}
+}
@@ -7,7 +7,63 @@ import (
 func consoleCompleter(console *Console) *readline.PrefixCompleter {
 	return readline.NewPrefixCompleter(
 		readline.PcItem(":exit"),
+		readline.PcItem(":!"),
 		readline.PcItem(":connect", readline.PcItemDynamic(console.listConnections())),
+		readline.PcItem(":connections"),
+		readline.PcItem(":switch", readline.PcItemDynamic(console.listConnectionNames())),
+		readline.PcItem(":compare"),
+		readline.PcItem(":diff"),
+		readline.PcItem(":transport",
+			readline.PcItem("json"),
+			readline.PcItem("protobuf")),
+		readline.PcItem(":query-options",
+			readline.PcItem("columnAttrs="),
+			readline.PcItem("slices=")),
+		readline.PcItem(":format",
+			readline.PcItem("json"),
+			readline.PcItem("compact"),
+			readline.PcItem("table"),
+			readline.PcItem("csv"),
+			readline.PcItem("yaml"),
+			readline.PcItem("raw"),
+			readline.PcItem("template")),
+		readline.PcItem(":bit-limit",
+			readline.PcItem("off")),
+		readline.PcItem(":export"),
+		readline.PcItem(":assert"),
+		readline.PcItem(":pager",
+			readline.PcItem("on"),
+			readline.PcItem("off"),
+			readline.PcItem("auto")),
+		readline.PcItem(":stream",
+			readline.PcItem("on"),
+			readline.PcItem("off")),
+		readline.PcItem(":response-limit"),
+		readline.PcItem(":health",
+			readline.PcItem("auto",
+				readline.PcItem("on"),
+				readline.PcItem("off"))),
+		readline.PcItem(":stats",
+			readline.PcItem("reset")),
+		readline.PcItem(":status",
+			readline.PcItem("watch")),
+		// commands supported by the server, which take an index
+		readline.PcItemDynamic(console.listSupportedCommands(":slices", ":fragment", ":check-consistency"),
+			readline.PcItemDynamic(console.listIndexes())),
+		readline.PcItem(":admin",
+			readline.PcItem("recalculate-caches"),
+			readline.PcItem("restore-frame", readline.PcItemDynamic(console.listIndexes())),
+			readline.PcItem("attr-diff", readline.PcItemDynamic(console.listConnectionNames()))),
+		readline.PcItem(":dashboard"),
+		readline.PcItem(":metrics",
+			readline.PcItem("watch")),
+		readline.PcItem(":footer",
+			readline.PcItem("on"),
+			readline.PcItem("off")),
+		readline.PcItem(":trace",
+			readline.PcItem("on"),
+			readline.PcItem("off"),
+			readline.PcItem("verbose")),
 		readline.PcItem(":use", readline.PcItemDynamic(console.listIndexes())),
 		readline.PcItem(":ensure",
 			readline.PcItem("index"),
@@ -27,17 +83,7 @@ func consoleCompleter(console *Console) *readline.PrefixCompleter {
 			readline.PcItem("delete"),
 			readline.PcItem("patch")),
 
-		// PQL commands
-		readline.PcItem("Bitmap("),
-		readline.PcItem("ClearBit("),
-		readline.PcItem("Count("),
-		readline.PcItem("Difference("),
-		readline.PcItem("Intersect("),
-		readline.PcItem("Range("),
-		readline.PcItem("SetBit("),
-		readline.PcItem("SetColumnAttrs("),
-		readline.PcItem("SetRowAttrs("),
-		readline.PcItem("TopN("),
-		readline.PcItem("Union("),
+		// PQL commands supported by the server
+		readline.PcItemDynamic(console.listPQLCalls()),
 	)
 }
@@ -0,0 +1,176 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"strings"
+	"sync"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+const defaultConnectionName = "default"
+
+type connection struct {
+	name         string
+	uri          *pilosa.URI
+	httpClient   *Client
+	pilosaClient *pilosa.Client
+	// probe checks the health of the server and its nodes, it is kept across reconnects.
+	probe *Client
+	// proxy traces the requests of pilosaClient, it is only set while tracing is on.
+	proxy   *tracingProxy
+	schema  *pilosa.Schema
+	version string
+	semver  *semver
+	tracer  *tracer
+	state   connectionState
+	// reconnect is set when the server was down, so the clients are recreated once it is back.
+	reconnect bool
+	mu        sync.Mutex
+}
+
+func newConnection(name string, addr string, tracer *tracer) (*connection, error) {
+	uri, err := pilosa.NewURIFromAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	probe, err := newProbeClient(uri.Normalize())
+	if err != nil {
+		return nil, err
+	}
+	conn := &connection{
+		name:   name,
+		uri:    uri,
+		probe:  probe,
+		tracer: tracer,
+		state:  stateOK,
+	}
+	err = conn.connect()
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connect creates the clients, and retrieves the schema and the server version.
+func (conn *connection) connect() error {
+	httpClient, err := NewClient(conn.uri.Normalize())
+	if err != nil {
+		return err
+	}
+	httpClient.httpClient.Transport = &tracingTransport{
+		transport: httpClient.httpClient.Transport,
+		tracer:    conn.tracer,
+	}
+	conn.closeClients()
+	conn.httpClient = httpClient
+	conn.pilosaClient = pilosa.NewClientWithURI(conn.uri)
+	err = conn.setTracing(conn.tracer.getLevel() != traceOff)
+	if err != nil {
+		return err
+	}
+	err = conn.updateSchema()
+	if err != nil {
+		return err
+	}
+	conn.version, _ = httpClient.serverVersion()
+	conn.semver = nil
+	if v, err := parseSemver(conn.version); err == nil {
+		conn.semver = &v
+	}
+	return nil
+}
+
+// setTracing sends the requests of the Go client through a tracing proxy while tracing is on.
+// The proxy only runs while it is needed, since any local process can send requests through it.
+func (conn *connection) setTracing(on bool) error {
+	if on == (conn.proxy != nil) {
+		return nil
+	}
+	if !on {
+		conn.proxy.close()
+		conn.proxy = nil
+		conn.pilosaClient = pilosa.NewClientWithURI(conn.uri)
+		return nil
+	}
+	proxy, err := newTracingProxy(conn.uri, conn.tracer)
+	if err != nil {
+		return err
+	}
+	conn.proxy = proxy
+	conn.pilosaClient = pilosa.NewClientWithURI(proxy.uri)
+	return nil
+}
+
+// close releases all the clients of the connection.
+func (conn *connection) close() {
+	conn.closeClients()
+	conn.probe.close()
+}
+
+// closeClients releases the clients which are recreated on reconnect.
+func (conn *connection) closeClients() {
+	if conn.httpClient != nil {
+		conn.httpClient.close()
+	}
+	if conn.proxy != nil {
+		conn.proxy.close()
+		conn.proxy = nil
+	}
+}
+
+func (conn *connection) address() string {
+	return conn.uri.Normalize()
+}
+
+func (conn *connection) updateSchema() error {
+	schema, err := conn.pilosaClient.Schema()
+	if err != nil {
+		return err
+	}
+	conn.schema = schema
+	return nil
+}
+
+// parseConnectionArg splits a :connect argument of the form name=address.
+func parseConnectionArg(arg string) (name string, addr string) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return defaultConnectionName, arg
+}
@@ -0,0 +1,353 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HashBlockSize is the number of rows in a fragment block.
+const HashBlockSize = 100
+
+const consistencyCheckWorkers = 8
+
+// checksumBlock is the checksum of a block of a fragment or of attributes.
+type checksumBlock struct {
+	ID       uint64 `json:"id"`
+	Checksum []byte `json:"checksum"`
+}
+
+// missingChecksum is displayed for a block of a fragment which does not exist on a node.
+const missingChecksum = "missing"
+
+type fragmentID struct {
+	frame string
+	view  string
+	slice uint64
+}
+
+type blockDivergence struct {
+	fragmentID
+	block     uint64
+	checksums map[string]string
+}
+
+type fragmentFailure struct {
+	fragmentID
+	host string
+	err  error
+}
+
+type consistencyReport struct {
+	fragments   int
+	divergences []*blockDivergence
+	failures    []*fragmentFailure
+}
+
+// failedFragments returns the number of fragments which could not be checked on at least one node.
+func (r *consistencyReport) failedFragments() int {
+	failed := map[fragmentID]bool{}
+	for _, failure := range r.failures {
+		failed[failure.fragmentID] = true
+	}
+	return len(failed)
+}
+
+// frameViews returns the views of a frame, e.g. standard, inverse and the views of time quantums.
+func (c *Client) frameViews(index string, frame string) ([]string, error) {
+	response, err := c.httpGet("/index/" + url.PathEscape(index) + "/frame/" + url.PathEscape(frame) + "/views")
+	if err != nil {
+		return nil, err
+	}
+	views := struct {
+		Views []string `json:"views"`
+	}{}
+	err = json.Unmarshal(response.Body, &views)
+	if err != nil {
+		return nil, err
+	}
+	return views.Views, nil
+}
+
+// fragmentBlocks returns the blocks of a fragment. A fragment which does not exist on the node has no blocks.
+func (c *Client) fragmentBlocks(index string, frame string, view string, slice uint64) ([]*checksumBlock, error) {
+	query := url.Values{}
+	query.Set("index", index)
+	query.Set("frame", frame)
+	query.Set("view", view)
+	query.Set("slice", strconv.FormatUint(slice, 10))
+	response, err := c.doRequest("GET", "/fragment/blocks?"+query.Encode(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return []*checksumBlock{}, nil
+	}
+	if !response.succeeded() {
+		return nil, fmt.Errorf("%s: %s", response.status, response.Body)
+	}
+	blocks := struct {
+		Blocks []*checksumBlock `json:"blocks"`
+	}{}
+	err = json.Unmarshal(response.Body, &blocks)
+	if err != nil {
+		return nil, err
+	}
+	return blocks.Blocks, nil
+}
+
+// checkConsistency compares the block checksums of each fragment of all views of the given frames
+// on all nodes which own it. Slices are checked concurrently by the given number of workers.
+// The nodes are queried with clients which share the HTTP client of the given client.
+func checkConsistency(client *Client, index string, frames []string, workers int, progress func(done int, total int)) (*consistencyReport, error) {
+	maxSlices, err := client.maxSlices()
+	if err != nil {
+		return nil, err
+	}
+	maxSlice, ok := maxSlices[index]
+	if !ok {
+		return nil, fmt.Errorf("Index not found: %s", index)
+	}
+	// the fragments of a slice, they are owned by the same nodes
+	sliceFragments := []fragmentID{}
+	for _, frame := range frames {
+		views, err := client.frameViews(index, frame)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot list the views of frame %s: %s", frame, err)
+		}
+		sort.Strings(views)
+		for _, view := range views {
+			sliceFragments = append(sliceFragments, fragmentID{frame: frame, view: view})
+		}
+	}
+
+	total := len(sliceFragments) * int(maxSlice+1)
+	report := &consistencyReport{fragments: total}
+	nodeClients := &nodeClients{client: client, clients: map[string]*Client{}}
+	jobs := make(chan uint64)
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	done := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slice := range jobs {
+				nodes, err := client.fragmentNodes(index, slice)
+				for _, id := range sliceFragments {
+					id.slice = slice
+					var divergences []*blockDivergence
+					var failures []*fragmentFailure
+					if err != nil {
+						failures = []*fragmentFailure{{fragmentID: id, host: client.URI.Normalize(), err: err}}
+					} else {
+						divergences, failures = checkFragment(nodeClients, index, id, nodes)
+					}
+					mu.Lock()
+					report.divergences = append(report.divergences, divergences...)
+					report.failures = append(report.failures, failures...)
+					done++
+					if progress != nil {
+						progress(done, total)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for slice := uint64(0); slice <= maxSlice; slice++ {
+		jobs <- slice
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(report.divergences, func(i, j int) bool {
+		a, b := report.divergences[i], report.divergences[j]
+		if a.frame != b.frame {
+			return a.frame < b.frame
+		}
+		if a.view != b.view {
+			return a.view < b.view
+		}
+		if a.slice != b.slice {
+			return a.slice < b.slice
+		}
+		return a.block < b.block
+	})
+	return report, nil
+}
+
+// nodeClients keeps a client for each node during a consistency check.
+type nodeClients struct {
+	client  *Client
+	clients map[string]*Client
+	mu      sync.Mutex
+}
+
+func (n *nodeClients) get(host string) (*Client, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if client, ok := n.clients[host]; ok {
+		return client, nil
+	}
+	client, err := n.client.forHost(host)
+	if err != nil {
+		return nil, err
+	}
+	n.clients[host] = client
+	return client, nil
+}
+
+// checkFragment compares the block checksums of a fragment on the nodes which own its slice.
+func checkFragment(nodeClients *nodeClients, index string, id fragmentID, nodes []*fragmentNode) ([]*blockDivergence, []*fragmentFailure) {
+	failures := []*fragmentFailure{}
+	// block ID -> host -> checksum
+	checksums := map[uint64]map[string]string{}
+	hosts := []string{}
+	for _, node := range nodes {
+		nodeClient, err := nodeClients.get(node.Host)
+		if err == nil {
+			var blocks []*checksumBlock
+			blocks, err = nodeClient.fragmentBlocks(index, id.frame, id.view, id.slice)
+			for _, block := range blocks {
+				if checksums[block.ID] == nil {
+					checksums[block.ID] = map[string]string{}
+				}
+				checksums[block.ID][node.Host] = hex.EncodeToString(block.Checksum)
+			}
+		}
+		if err != nil {
+			failures = append(failures, &fragmentFailure{fragmentID: id, host: node.Host, err: err})
+			continue
+		}
+		hosts = append(hosts, node.Host)
+	}
+
+	divergences := []*blockDivergence{}
+	for block, blockChecksums := range checksums {
+		diverged := false
+		for _, host := range hosts {
+			if blockChecksums[host] != blockChecksums[hosts[0]] {
+				diverged = true
+				break
+			}
+		}
+		if !diverged {
+			continue
+		}
+		// blocks which are missing on a node, including missing fragments, are divergent
+		for _, host := range hosts {
+			if _, ok := blockChecksums[host]; !ok {
+				blockChecksums[host] = missingChecksum
+			}
+		}
+		divergences = append(divergences, &blockDivergence{
+			fragmentID: id,
+			block:      block,
+			checksums:  blockChecksums,
+		})
+	}
+	return divergences, failures
+}
+
+func (c *Console) executeCheckConsistencyCommand(cmd string, args []string) error {
+	if c.conn == nil {
+		return errNotConnected
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: :check-consistency index-name [frame-name]")
+	}
+	indexName := args[0]
+	frames := []string{}
+	if len(args) == 2 {
+		frames = append(frames, args[1])
+	} else {
+		err := c.updateSchema()
+		if err != nil {
+			return err
+		}
+		for _, index := range c.conn.schema.Indexes() {
+			if index.Name() != indexName {
+				continue
+			}
+			for _, frame := range index.Frames() {
+				frames = append(frames, frame.Name())
+			}
+		}
+		if len(frames) == 0 {
+			return fmt.Errorf("No frames found in index: %s", indexName)
+		}
+		sort.Strings(frames)
+	}
+
+	report, err := checkConsistency(c.conn.httpClient, indexName, frames, consistencyCheckWorkers,
+		func(done int, total int) {
+			fmt.Printf("\rChecked %d/%d fragments", done, total)
+		})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	for _, failure := range report.failures {
+		printWarning(fmt.Sprintf("Cannot check frame %s view %s slice %d on %s: %s",
+			failure.frame, failure.view, failure.slice, failure.host, failure.err))
+	}
+	for _, d := range report.divergences {
+		hosts := make([]string, 0, len(d.checksums))
+		for host, checksum := range d.checksums {
+			hosts = append(hosts, fmt.Sprintf("%s=%s", host, checksum))
+		}
+		sort.Strings(hosts)
+		fmt.Fprintf(c.stdout, "%s frame %s view %s slice %d block %d (rows %d-%d): %s\n",
+			colorString(fgRed, "DIVERGED"), d.frame, d.view, d.slice, d.block,
+			d.block*HashBlockSize, (d.block+1)*HashBlockSize-1, strings.Join(hosts, " "))
+	}
+	if len(report.divergences) == 0 && len(report.failures) == 0 {
+		fmt.Fprintln(c.stdout, colorString(fgGreen, fmt.Sprintf("All %d fragments are consistent", report.fragments)))
+	} else {
+		printWarning(fmt.Sprintf("%d divergent blocks, %d fragments could not be checked",
+			len(report.divergences), report.failedFragments()))
+	}
+	return nil
+}
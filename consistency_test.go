@@ -0,0 +1,190 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeNode serves the fragment endpoints of a Pilosa node. blocks maps a view to the block checksums
+// of each slice, slices which are not in it have no fragment on the node.
+type fakeNode struct {
+	server *httptest.Server
+	nodes  *[]string
+	blocks map[string]map[uint64]map[uint64]string
+	// nodeRequests counts the requests for the nodes of a slice.
+	nodeRequests int32
+}
+
+func newFakeNode(nodes *[]string, blocks map[string]map[uint64]map[uint64]string) *fakeNode {
+	node := &fakeNode{nodes: nodes, blocks: blocks}
+	node.server = httptest.NewServer(http.HandlerFunc(node.serve))
+	return node
+}
+
+func (n *fakeNode) host() string {
+	return strings.TrimPrefix(n.server.URL, "http://")
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/slices/max":
+		json.NewEncoder(w).Encode(map[string]interface{}{"maxSlices": map[string]uint64{"i": 2}})
+	case "/index/i/frame/f/views":
+		views := []string{}
+		for view := range n.blocks {
+			views = append(views, view)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"views": views})
+	case "/fragment/nodes":
+		atomic.AddInt32(&n.nodeRequests, 1)
+		nodes := []map[string]string{}
+		for _, host := range *n.nodes {
+			nodes = append(nodes, map[string]string{"host": host})
+		}
+		json.NewEncoder(w).Encode(nodes)
+	case "/fragment/blocks":
+		slice, _ := strconv.ParseUint(r.URL.Query().Get("slice"), 10, 64)
+		checksums, ok := n.blocks[r.URL.Query().Get("view")][slice]
+		if !ok {
+			http.Error(w, "fragment not found", http.StatusNotFound)
+			return
+		}
+		blocks := []*checksumBlock{}
+		for id, checksum := range checksums {
+			blocks = append(blocks, &checksumBlock{ID: id, Checksum: []byte(checksum)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"blocks": blocks})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	nodes := []string{}
+	// slice 0 matches, block 2 of slice 1 diverges, slice 2 is missing on the second node,
+	// block 3 of slice 0 of the inverse view diverges
+	first := newFakeNode(&nodes, map[string]map[uint64]map[uint64]string{
+		"standard": {0: {0: "a", 1: "b"}, 1: {0: "a", 2: "c"}, 2: {5: "d"}},
+		"inverse":  {0: {3: "e"}},
+	})
+	defer first.server.Close()
+	second := newFakeNode(&nodes, map[string]map[uint64]map[uint64]string{
+		"standard": {0: {0: "a", 1: "b"}, 1: {0: "a", 2: "x"}},
+		"inverse":  {0: {3: "y"}},
+	})
+	defer second.server.Close()
+	nodes = append(nodes, first.host(), second.host())
+
+	client, err := NewClient(first.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := checkConsistency(client, "i", []string{"f"}, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.fragments != 6 {
+		t.Errorf("fragments = %d, want 6", report.fragments)
+	}
+	if requests := atomic.LoadInt32(&first.nodeRequests); requests != 3 {
+		t.Errorf("the nodes of each slice should be requested once, got %d requests", requests)
+	}
+	if len(report.failures) != 0 {
+		t.Fatalf("unexpected failures: %v", report.failures[0].err)
+	}
+	want := []struct {
+		view         string
+		slice, block uint64
+	}{
+		{"inverse", 0, 3},
+		{"standard", 1, 2},
+		{"standard", 2, 5},
+	}
+	if len(report.divergences) != len(want) {
+		t.Fatalf("divergences = %d, want %d", len(report.divergences), len(want))
+	}
+	for i, w := range want {
+		d := report.divergences[i]
+		if d.frame != "f" || d.view != w.view || d.slice != w.slice || d.block != w.block {
+			t.Errorf("divergence %d is %s/%s slice %d block %d, want f/%s slice %d block %d",
+				i, d.frame, d.view, d.slice, d.block, w.view, w.slice, w.block)
+		}
+		if d.checksums[first.host()] == d.checksums[second.host()] {
+			t.Errorf("checksums of the divergent block are the same: %v", d.checksums)
+		}
+	}
+	missing := report.divergences[2]
+	if missing.checksums[second.host()] != missingChecksum {
+		t.Errorf("checksum on the node without the fragment = %q, want %q", missing.checksums[second.host()], missingChecksum)
+	}
+}
+
+func TestCheckConsistencyUnreachableNode(t *testing.T) {
+	nodes := []string{}
+	node := newFakeNode(&nodes, map[string]map[uint64]map[uint64]string{
+		"standard": {0: {0: "a"}, 1: {0: "a"}, 2: {0: "a"}},
+	})
+	defer node.server.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	downHost := strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+	// the unreachable node is listed twice, its failures are counted once per fragment
+	nodes = append(nodes, node.host(), downHost, downHost)
+
+	client, err := NewClient(node.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := checkConsistency(client, "i", []string{"f"}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.failures) != 6 || report.failedFragments() != 3 {
+		t.Fatalf("failures = %d for %d fragments, want 6 for 3", len(report.failures), report.failedFragments())
+	}
+	if report.failures[0].host != downHost {
+		t.Errorf("failed host = %s, want %s", report.failures[0].host, downHost)
+	}
+	if len(report.divergences) != 0 {
+		t.Errorf("divergences = %d, want 0", len(report.divergences))
+	}
+}
@@ -43,24 +43,53 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/chzyer/readline"
 	pilosa "github.com/pilosa/go-pilosa"
 )
 
 type Console struct {
-	httpClient        *Client
-	pilosaClient      *pilosa.Client
+	conn              *connection
+	connections       map[string]*connection
 	index             *pilosa.Index
 	prompt            *promptInfo
-	lastResponse      []byte
+	lastResponse      *decodedResponse
 	inst              *readline.Instance
 	homeDirectory     string
 	sessionsDirectory string
 	session           []string
 	sessionName       string
-	schema            *pilosa.Schema
+	tracer            *tracer
+	stats             *queryStats
+	showFooter        bool
+	healthMonitor     *healthMonitor
+	queryOptions      *queryOptions
+	streaming         bool
+	maxResponseSize   int
+	spillDirectory    string
+	format            outputFormat
+	template          *template.Template
+	pager             pagerMode
+	bitLimit          int
+	responses         []*savedResponse
+	responseCount     int
+	redirect          *redirect
+	piping            bool
+	terminalReleased  bool
+	// input is the standard input shared by readline, the dashboard and the pager.
+	input *terminalInput
+	// stdout receives the output of queries and commands, errors and warnings always go to the terminal.
+	stdout io.Writer
+	// promptMu guards the prompt and readline against redraws by the health monitor.
+	promptMu sync.Mutex
+	// promptText is the prompt without the health of promptConn.
+	promptText string
+	promptConn *connection
 }
 
 func NewConsole(homeDirectory string) (*Console, error) {
@@ -69,37 +98,88 @@ func NewConsole(homeDirectory string) (*Console, error) {
 		sessionsDirectory = path.Join(homeDirectory, "sessions")
 	}
 	console := &Console{
+		connections:       map[string]*connection{},
 		prompt:            &promptInfo{address: "(not connected)", index: "(no index)"},
 		homeDirectory:     homeDirectory,
 		sessionsDirectory: sessionsDirectory,
 		session:           []string{},
 		sessionName:       autoSessionName(),
+		tracer:            newTracer(),
+		stdout:            os.Stdout,
+		stats:             newQueryStats(),
+		showFooter:        true,
+		queryOptions:      &queryOptions{transport: transportJSON},
+		maxResponseSize:   defaultMaxResponseSize,
+		bitLimit:          defaultBitLimit,
+		input:             newTerminalInput(os.Stdin),
 	}
-	completer := consoleCompleter(console)
+	if homeDirectory != "" {
+		console.spillDirectory = path.Join(homeDirectory, "responses")
+	}
+	err := console.openReadline()
+	if err != nil {
+		return nil, err
+	}
+	return console, nil
+}
+
+// openReadline creates the readline instance. It is called again after
+// the terminal was taken over by the dashboard or the pager.
+func (c *Console) openReadline() error {
 	config := &readline.Config{
-		AutoComplete:      completer,
+		AutoComplete:      consoleCompleter(c),
 		InterruptPrompt:   "^C",
 		EOFPrompt:         ":exit",
 		HistorySearchFold: true,
+		Stdin:             c.input.reader(),
 	}
-	if homeDirectory != "" {
-		config.HistoryFile = path.Join(homeDirectory, "history")
+	if c.homeDirectory != "" {
+		config.HistoryFile = path.Join(c.homeDirectory, "history")
 	}
 	inst, err := readline.NewEx(config)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	console.inst = inst
-	return console, nil
+	c.inst = inst
+	log.SetOutput(inst.Stderr())
+	return nil
+}
+
+// releaseTerminal closes readline while fn uses the terminal, since readline
+// reads the standard input in the background, and opens it again afterwards.
+func (c *Console) releaseTerminal(fn func() error) error {
+	if c.terminalReleased {
+		return fn()
+	}
+	c.promptMu.Lock()
+	c.inst.Close()
+	c.terminalReleased = true
+	c.promptMu.Unlock()
+	defer func() {
+		c.promptMu.Lock()
+		err := c.openReadline()
+		c.terminalReleased = false
+		c.promptMu.Unlock()
+		if err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		c.updatePrompt()
+	}()
+	return fn()
 }
 
 func (c *Console) Close() {
+	c.stopHealthMonitor()
+	for _, conn := range c.connections {
+		conn.close()
+	}
+	c.tracer.close()
 	c.inst.Close()
 }
 
 func (c *Console) Main() {
 	c.ensureHomeDirectoryExists()
-	log.SetOutput(c.inst.Stderr())
 	c.updatePrompt()
 	lines := []string{}
 	for {
@@ -116,7 +196,7 @@ func (c *Console) Main() {
 		}
 		line = strings.TrimSpace(line)
 		if strings.HasSuffix(line, "\\") {
-			c.inst.SetPrompt(">>> ")
+			c.setPrompt(">>> ", nil)
 			lines = append(lines, strings.TrimRight(line, "\\"))
 			continue
 		}
@@ -126,22 +206,13 @@ func (c *Console) Main() {
 			lines = []string{}
 			c.updatePrompt()
 		}
-		switch {
-		case line == "":
+		if line == "" {
 			continue
-		case line == ":exit":
+		}
+		if line == ":exit" {
 			goto exit
-		case strings.HasPrefix(line, "#"):
-			c.inst.Operation.SetBuffer("# ")
-		case strings.HasPrefix(line, ":"):
-			err = c.executeCommand(line)
-		case line == "_":
-			if c.lastResponse != nil {
-				fmt.Println(string(tryPrettifyJSON(c.lastResponse)))
-			}
-		default:
-			err = c.executeQuery(line)
 		}
+		err = c.executeLine(line)
 
 		if err != nil {
 			printError(err)
@@ -159,11 +230,84 @@ func (c *Console) Main() {
 exit:
 }
 
+func (c *Console) executeLine(line string) (err error) {
+	if strings.HasPrefix(line, "@") {
+		return c.executeOnConnection(line)
+	}
+	if strings.HasPrefix(line, ":!") {
+		return c.executeShellCommand(strings.TrimSpace(line[2:]))
+	}
+	if !strings.HasPrefix(line, "#") {
+		rest, command, err := splitPipe(line)
+		if err != nil {
+			return err
+		}
+		if command != "" {
+			return c.executePiped(rest, command)
+		}
+	}
+	if canRedirect(line) {
+		var target *redirect
+		line, target, err = splitRedirect(line)
+		if err != nil {
+			return err
+		}
+		c.redirect = target
+		defer func() {
+			c.redirect = nil
+		}()
+	}
+	conn := c.conn
+	if conn != nil {
+		c.ensureConnected(conn)
+	}
+	switch {
+	case strings.HasPrefix(line, "#"):
+		c.inst.Operation.SetBuffer("# ")
+	case strings.HasPrefix(line, ":"):
+		err = c.executeCommand(line)
+	case isResponseLine(line):
+		err = c.executeShowResponse(line)
+	default:
+		err = c.executeQuery(line)
+	}
+	if err != nil && conn != nil && conn == c.conn {
+		c.checkConnection(conn)
+	}
+	return err
+}
+
+// executeOnConnection runs a line prefixed with @name using the named connection,
+// leaving the active connection unchanged.
+func (c *Console) executeOnConnection(line string) error {
+	name := strings.Fields(line)[0]
+	rest := strings.TrimSpace(line[len(name):])
+	name = name[1:]
+	if rest == "" {
+		return errors.New("usage: @connection-name query or command")
+	}
+	conn, ok := c.connections[name]
+	if !ok {
+		return fmt.Errorf("Unknown connection: %s", name)
+	}
+	// the active connection is restored afterwards, so commands which change it are not allowed
+	switch command := strings.Fields(rest)[0]; command {
+	case ":connect", ":switch":
+		return fmt.Errorf("%s changes the active connection and cannot be run with @%s", command, name)
+	}
+	active := c.conn
+	c.conn = conn
+	defer func() {
+		c.conn = active
+	}()
+	return c.executeLine(rest)
+}
+
 func (c *Console) listIndexes() func(string) []string {
 	return func(line string) []string {
 		indexNames := []string{}
-		if c.schema != nil {
-			for _, index := range c.schema.Indexes() {
+		if c.conn != nil && c.conn.schema != nil {
+			for _, index := range c.conn.schema.Indexes() {
 				indexNames = append(indexNames, index.Name())
 			}
 		}
@@ -171,6 +315,48 @@ func (c *Console) listIndexes() func(string) []string {
 	}
 }
 
+func (c *Console) listPQLCalls() func(string) []string {
+	return func(line string) []string {
+		var version *semver
+		if c.conn != nil {
+			version = c.conn.semver
+		}
+		calls := supportedPQLCalls(version)
+		for i, call := range calls {
+			calls[i] = call + "("
+		}
+		return calls
+	}
+}
+
+// listSupportedCommands returns the commands among names which the server supports.
+func (c *Console) listSupportedCommands(names ...string) func(string) []string {
+	return func(line string) []string {
+		var version *semver
+		if c.conn != nil {
+			version = c.conn.semver
+		}
+		supported := []string{}
+		for _, name := range names {
+			if checkCommandSupported(version, name) == nil {
+				supported = append(supported, name)
+			}
+		}
+		return supported
+	}
+}
+
+func (c *Console) listConnectionNames() func(string) []string {
+	return func(line string) []string {
+		names := make([]string, 0, len(c.connections))
+		for name := range c.connections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+}
+
 func (c *Console) listConnections() func(string) []string {
 	return func(line string) []string {
 		addrs := []string{}
@@ -201,9 +387,19 @@ func (c *Console) listConnections() func(string) []string {
 func (c *Console) executeCommand(line string) (err error) {
 	args := strings.Fields(line)
 	cmd := args[0]
+	if c.conn != nil {
+		err = checkCommandSupported(c.conn.semver, cmd)
+		if err != nil {
+			return err
+		}
+	}
 	switch cmd {
 	case ":connect":
 		err = c.executeConnectCommand(cmd, args[1:])
+	case ":connections":
+		err = c.executeConnectionsCommand(cmd, args[1:])
+	case ":switch":
+		err = c.executeSwitchCommand(cmd, args[1:])
 	case ":use":
 		err = c.executeUseCommand(cmd, args[1:])
 	case ":ensure":
@@ -220,6 +416,50 @@ func (c *Console) executeCommand(line string) (err error) {
 		err = c.executeSchemaCommand(cmd, args[1:])
 	case ":http":
 		err = c.executeHTTPCommand(cmd, args[1:])
+	case ":compare":
+		err = c.executeCompareCommand(cmd, args[1:], line)
+	case ":trace":
+		err = c.executeTraceCommand(cmd, args[1:])
+	case ":stats":
+		err = c.executeStatsCommand(cmd, args[1:])
+	case ":footer":
+		err = c.executeFooterCommand(cmd, args[1:])
+	case ":status":
+		err = c.executeStatusCommand(cmd, args[1:])
+	case ":slices":
+		err = c.executeSlicesCommand(cmd, args[1:])
+	case ":fragment":
+		err = c.executeFragmentCommand(cmd, args[1:])
+	case ":transport":
+		err = c.executeTransportCommand(cmd, args[1:])
+	case ":query-options":
+		err = c.executeQueryOptionsCommand(cmd, args[1:])
+	case ":format":
+		err = c.executeFormatCommand(cmd, args[1:], line)
+	case ":bit-limit":
+		err = c.executeBitLimitCommand(cmd, args[1:])
+	case ":assert":
+		err = c.executeAssertCommand(cmd, args[1:])
+	case ":diff":
+		err = c.executeDiffCommand(cmd, args[1:], line)
+	case ":export":
+		err = c.executeExportCommand(cmd, args[1:])
+	case ":pager":
+		err = c.executePagerCommand(cmd, args[1:])
+	case ":stream":
+		err = c.executeStreamCommand(cmd, args[1:])
+	case ":response-limit":
+		err = c.executeResponseLimitCommand(cmd, args[1:])
+	case ":health":
+		err = c.executeHealthCommand(cmd, args[1:])
+	case ":admin":
+		err = c.executeAdminCommand(cmd, args[1:])
+	case ":dashboard":
+		err = c.executeDashboardCommand(cmd, args[1:])
+	case ":metrics":
+		err = c.executeMetricsCommand(cmd, args[1:])
+	case ":check-consistency":
+		err = c.executeCheckConsistencyCommand(cmd, args[1:])
 	default:
 		err = fmt.Errorf("Invalid command: %s", cmd)
 	}
@@ -228,34 +468,82 @@ func (c *Console) executeCommand(line string) (err error) {
 
 func (c *Console) executeConnectCommand(cmd string, args []string) error {
 	if len(args) != 1 {
-		return errors.New("usage: :connect pilosa-address")
+		return errors.New("usage: :connect [name=]pilosa-address")
 	}
-	uri, err := pilosa.NewURIFromAddress(args[0])
-	if err != nil {
-		return err
+	name, addr := parseConnectionArg(args[0])
+	if name == "" {
+		return errors.New("Connection name cannot be empty")
 	}
-	c.pilosaClient = pilosa.NewClientWithURI(uri)
-	c.httpClient, _ = NewClient(uri.Normalize())
-	err = c.updateSchema()
+	conn, err := newConnection(name, addr, c.tracer)
 	if err != nil {
-		c.pilosaClient = nil
-		c.httpClient = nil
 		return err
 	}
-	version, _ := c.httpClient.serverVersion()
-	if err == nil {
-		fmt.Println("Pilosa server version:", version)
+	if conn.version != "" {
+		fmt.Fprintln(c.stdout, "Pilosa server version:", conn.version)
+		if conn.semver == nil {
+			printWarning("Cannot parse the server version, all features are enabled")
+		}
 	}
-	c.prompt.address = uri.Normalize()
-	c.updatePrompt()
+	if previous, ok := c.connections[name]; ok {
+		previous.close()
+	}
+	c.connections[name] = conn
+	c.activateConnection(conn)
 	return nil
 }
 
+func (c *Console) executeConnectionsCommand(cmd string, args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: :connections")
+	}
+	if len(c.connections) == 0 {
+		return errNotConnected
+	}
+	for _, name := range c.listConnectionNames()("") {
+		conn := c.connections[name]
+		marker := " "
+		if conn == c.conn {
+			marker = "*"
+		}
+		c.checkConnection(conn)
+		state := conn.getState()
+		version := conn.version
+		if version == "" {
+			version = "(unknown version)"
+		}
+		fmt.Fprintf(c.stdout, "%s %s\t%s\t%s\t%s\n", marker, name, conn.address(), version,
+			colorString(state.color(), state.String()))
+	}
+	return nil
+}
+
+func (c *Console) executeSwitchCommand(cmd string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: :switch connection-name")
+	}
+	conn, ok := c.connections[args[0]]
+	if !ok {
+		return fmt.Errorf("Unknown connection: %s", args[0])
+	}
+	c.activateConnection(conn)
+	return nil
+}
+
+func (c *Console) activateConnection(conn *connection) {
+	c.conn = conn
+	c.prompt.address = conn.address()
+	c.prompt.connection = conn.name
+	c.updatePrompt()
+	if c.healthMonitor != nil {
+		c.startHealthMonitor(c.healthMonitor.interval)
+	}
+}
+
 func (c *Console) executeUseCommand(cmd string, args []string) (err error) {
 	if len(args) != 1 {
 		return errors.New("usage: :use index-name")
 	}
-	if c.pilosaClient == nil {
+	if c.conn == nil {
 		return errNotConnected
 	}
 	indexName := args[0]
@@ -269,7 +557,7 @@ func (c *Console) executeUseCommand(cmd string, args []string) (err error) {
 }
 
 func (c *Console) executeCreateOrEnsureCommand(cmd string, args []string) (err error) {
-	if c.pilosaClient == nil {
+	if c.conn == nil {
 		return errNotConnected
 	}
 	if len(args) < 2 {
@@ -283,6 +571,7 @@ func (c *Console) executeCreateOrEnsureCommand(cmd string, args []string) (err e
 
 	what := args[1]
 	which := args[0]
+	checkSchemaTarget(c.conn.semver, which, rawOptions)
 	switch which {
 	case "index":
 		options, err := makeIndexOptions(rawOptions)
@@ -295,9 +584,9 @@ func (c *Console) executeCreateOrEnsureCommand(cmd string, args []string) (err e
 		}
 		switch cmd {
 		case ":create":
-			err = c.pilosaClient.CreateIndex(c.index)
+			err = c.conn.pilosaClient.CreateIndex(c.index)
 		case ":ensure":
-			err = c.pilosaClient.EnsureIndex(c.index)
+			err = c.conn.pilosaClient.EnsureIndex(c.index)
 		default:
 			return fmt.Errorf("Invalid command in this context: %s", cmd)
 		}
@@ -321,9 +610,9 @@ func (c *Console) executeCreateOrEnsureCommand(cmd string, args []string) (err e
 		}
 		switch cmd {
 		case ":create":
-			err = c.pilosaClient.CreateFrame(frame)
+			err = c.conn.pilosaClient.CreateFrame(frame)
 		case ":ensure":
-			err = c.pilosaClient.EnsureFrame(frame)
+			err = c.conn.pilosaClient.EnsureFrame(frame)
 		default:
 			return fmt.Errorf("Invalid command in this context: %s", cmd)
 		}
@@ -334,7 +623,7 @@ func (c *Console) executeCreateOrEnsureCommand(cmd string, args []string) (err e
 }
 
 func (c *Console) executeDeleteCommand(cmd string, args []string) (err error) {
-	if c.pilosaClient == nil {
+	if c.conn == nil {
 		return errNotConnected
 	}
 	if len(args) < 2 {
@@ -350,7 +639,7 @@ func (c *Console) executeDeleteCommand(cmd string, args []string) (err error) {
 				printWarning(fmt.Sprintf("Skipping invalid index `%s`: %s", what, err))
 				continue
 			}
-			err = c.pilosaClient.DeleteIndex(c.index)
+			err = c.conn.pilosaClient.DeleteIndex(c.index)
 			if err != nil {
 				printError(fmt.Errorf("Error deleting index `%s`: %s", what, err))
 				continue
@@ -367,7 +656,7 @@ func (c *Console) executeDeleteCommand(cmd string, args []string) (err error) {
 				printWarning(fmt.Sprintf("Skipping invalid index `%s`: %s", what, err))
 				continue
 			}
-			err = c.pilosaClient.DeleteFrame(frame)
+			err = c.conn.pilosaClient.DeleteFrame(frame)
 			if err != nil {
 				printError(fmt.Errorf("Error deleting frame `%s`: %s", what, err))
 				continue
@@ -437,7 +726,7 @@ func (c *Console) executeSchemaCommand(cmd string, args []string) error {
 	if err != nil {
 		return err
 	}
-	for _, index := range c.schema.Indexes() {
+	for _, index := range c.conn.schema.Indexes() {
 		if indexName == "" || indexName == index.Name() {
 			frames := index.Frames()
 			frameList := make([]string, 0, len(frames))
@@ -445,9 +734,9 @@ func (c *Console) executeSchemaCommand(cmd string, args []string) error {
 				frameList = append(frameList, frame.Name())
 			}
 			if indexName != "" {
-				fmt.Printf("[%s]\n", strings.Join(frameList, ", "))
+				fmt.Fprintf(c.stdout, "[%s]\n", strings.Join(frameList, ", "))
 			} else {
-				fmt.Printf("%s [%s]\n", index.Name(), strings.Join(frameList, ", "))
+				fmt.Fprintf(c.stdout, "%s [%s]\n", index.Name(), strings.Join(frameList, ", "))
 			}
 		}
 	}
@@ -455,7 +744,7 @@ func (c *Console) executeSchemaCommand(cmd string, args []string) error {
 }
 
 func (c *Console) executeHTTPCommand(cmd string, args []string) error {
-	if c.httpClient == nil {
+	if c.conn == nil {
 		return errNotConnected
 	}
 	if len(args) < 2 {
@@ -470,34 +759,290 @@ func (c *Console) executeHTTPCommand(cmd string, args []string) error {
 	if len(args) >= 3 {
 		data = []byte(strings.Join(args[2:], " "))
 	}
-	response, err := c.httpClient.httpRequest(method, path, data)
+	response, err := c.conn.httpClient.httpRequest(method, path, data)
 	if err != nil {
 		return err
 	}
-	c.lastResponse = response.Body
-	fmt.Println(string(tryPrettifyJSON(response.Body)))
+	decoded := newDecodedResponse(response.Body, "")
+	c.saveResponse(decoded)
+	return c.emitResponse(decoded)
+}
+
+func (c *Console) executeTraceCommand(cmd string, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: :trace {on | off | verbose} [trace-file]")
+	}
+	level := traceOff
+	switch args[0] {
+	case "on":
+		level = traceOn
+	case "verbose":
+		level = traceVerbose
+	case "off":
+		if len(args) > 1 {
+			return errors.New("usage: :trace off")
+		}
+	default:
+		return fmt.Errorf("Invalid trace mode: %s", args[0])
+	}
+	path := ""
+	if len(args) == 2 {
+		path = args[1]
+	}
+	err := c.tracer.setOutput(path)
+	if err != nil {
+		return err
+	}
+	c.tracer.setLevel(level)
+	for _, conn := range c.connections {
+		err = conn.setTracing(level != traceOff)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (c *Console) executeQuery(line string) error {
-	if c.httpClient == nil {
+	if c.conn == nil {
 		return errNotConnected
 	}
 	if c.index == nil {
 		return errNoIndex
 	}
-	response, err := c.httpClient.query(c.index.Name(), line)
+	for _, call := range unsupportedPQLCalls(c.conn.semver, line) {
+		printWarning(fmt.Sprintf("%s is not supported by Pilosa %s", call, c.conn.semver))
+	}
+	// responses redirected as JSON are streamed to the file as they are,
+	// the other export formats need the whole response, e.g. for the column attributes
+	if c.streaming && c.queryOptions.transport == transportJSON && (c.redirect == nil || c.redirect.format == exportJSON) {
+		return c.executeStreamingQuery(line)
+	}
+	tic := time.Now()
+	response, err := c.conn.httpClient.query(c.index.Name(), line, c.queryOptions)
+	elapsed := time.Since(tic)
+	if err != nil {
+		return err
+	}
+	c.stats.add(line, elapsed)
+	decoded := response.decode(line)
+	number := c.saveResponse(decoded)
+	err = c.emitResponse(decoded)
 	if err != nil {
 		return err
 	}
-	c.lastResponse = response
-	fmt.Println(string(tryPrettifyJSON(c.lastResponse)))
+	if c.showFooter && !c.piping {
+		fmt.Println(colorString(attrDim, fmt.Sprintf("_%d: %s", number, queryFooter(decoded, response, elapsed))))
+	}
+	return nil
+}
+
+func (c *Console) executeTransportCommand(cmd string, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: :transport [json | protobuf]")
+	}
+	if len(args) == 0 {
+		transport := "json"
+		if c.queryOptions.transport == transportProtobuf {
+			transport = "protobuf"
+		}
+		fmt.Fprintln(c.stdout, "Query transport:", transport)
+		return nil
+	}
+	switch args[0] {
+	case "json":
+		c.queryOptions.transport = transportJSON
+	case "protobuf":
+		c.queryOptions.transport = transportProtobuf
+	default:
+		return fmt.Errorf("Invalid transport: %s", args[0])
+	}
+	return nil
+}
+
+func (c *Console) executeQueryOptionsCommand(cmd string, args []string) error {
+	if len(args) == 0 {
+		slices := "all"
+		if len(c.queryOptions.slices) > 0 {
+			slices = joinSlices(c.queryOptions.slices)
+		}
+		fmt.Fprintf(c.stdout, "columnAttrs=%t slices=%s gzip=%t\n", c.queryOptions.columnAttrs, slices, c.queryOptions.gzip)
+		return nil
+	}
+	rawOptions, err := parseOptions(args)
+	if err != nil {
+		return err
+	}
+	for k, v := range rawOptions {
+		switch k {
+		case "column_attrs", "columnAttrs":
+			b, err := parseBool(v)
+			if err != nil {
+				return err
+			}
+			c.queryOptions.columnAttrs = b
+		case "slices":
+			slices, err := parseSlices(v)
+			if err != nil {
+				return err
+			}
+			c.queryOptions.slices = slices
+		case "gzip":
+			b, err := parseBool(v)
+			if err != nil {
+				return err
+			}
+			c.queryOptions.gzip = b
+		default:
+			return fmt.Errorf("Invalid query option: %s", k)
+		}
+	}
 	return nil
 }
 
+func (c *Console) executeStatsCommand(cmd string, args []string) error {
+	if c.stats == nil {
+		// consoles which were not created by NewConsole have no statistics yet
+		c.stats = newQueryStats()
+	}
+	switch {
+	case len(args) == 0:
+		c.stats.print(c.stdout)
+	case len(args) == 1 && args[0] == "reset":
+		c.stats.reset()
+	default:
+		return errors.New("usage: :stats [reset]")
+	}
+	return nil
+}
+
+func (c *Console) executeFooterCommand(cmd string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: :footer {on | off}")
+	}
+	switch args[0] {
+	case "on":
+		c.showFooter = true
+	case "off":
+		c.showFooter = false
+	default:
+		return fmt.Errorf("Invalid footer mode: %s", args[0])
+	}
+	return nil
+}
+
+// renderResponse renders a response in the current output format.
+// Bitmaps with more bits than the bit limit are truncated.
+func (c *Console) renderResponse(response *decodedResponse) string {
+	return c.renderResponseLimit(response, c.bitLimit)
+}
+
+// emitResponse displays a response, or writes it to the file the line is redirected to.
+func (c *Console) emitResponse(response *decodedResponse) error {
+	return c.emitResponseLimit(response, c.bitLimit)
+}
+
+func (c *Console) emitResponseLimit(response *decodedResponse, bitLimit int) error {
+	if c.redirect != nil {
+		return c.redirect.write(response)
+	}
+	c.printOutput(c.renderResponseLimit(response, bitLimit))
+	return nil
+}
+
+func (c *Console) renderResponseLimit(response *decodedResponse, bitLimit int) string {
+	response, summaries := truncateBitmaps(response, bitLimit)
+	var text string
+	if c.format == formatTemplate {
+		var err error
+		text, err = renderTemplate(c.template, response, summaries)
+		if err != nil {
+			printError(err)
+			text = string(tryPrettifyJSON(response.jsonBody()))
+		}
+	} else {
+		text = formatResponse(c.format, response, summaries)
+	}
+	for _, summary := range summaries {
+		text += "\n" + colorString(attrDim, summary.String())
+	}
+	return text
+}
+
+// SetFormat sets the output format by name.
+func (c *Console) SetFormat(name string) error {
+	format, err := parseOutputFormat(name)
+	if err != nil {
+		return err
+	}
+	c.format = format
+	return nil
+}
+
+func (c *Console) executeFormatCommand(cmd string, args []string, line string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(c.stdout, "Output format:", c.format)
+		return nil
+	}
+	if args[0] == "template" {
+		if len(args) < 2 {
+			return errors.New("usage: :format template {'template' | template-name}")
+		}
+		// the template is taken as is from the line, so its spacing is kept
+		tmpl, err := c.parseOutputTemplate(lineAfterFields(line, 2))
+		if err != nil {
+			return err
+		}
+		c.template = tmpl
+		c.format = formatTemplate
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("usage: :format [json | compact | table | csv | yaml | raw | template {'template' | template-name}]")
+	}
+	return c.SetFormat(args[0])
+}
+
 func (c *Console) updatePrompt() {
-	c.inst.SetPrompt(fmt.Sprintf("\033[36m%s\033[0m/\033[1m\033[32m%s\033[37m>\033[0m ",
-		c.prompt.address, c.prompt.index))
+	connectionName := ""
+	if c.prompt.connection != "" && c.prompt.connection != defaultConnectionName {
+		connectionName = fmt.Sprintf("\033[33m%s\033[0m@", c.prompt.connection)
+	}
+	c.setPrompt(fmt.Sprintf("%s\033[36m%s\033[0m/\033[1m\033[32m%s\033[37m>\033[0m ",
+		connectionName, c.prompt.address, c.prompt.index), c.conn)
+}
+
+// setPrompt sets the prompt, prefixed with the health of conn unless it is nil.
+func (c *Console) setPrompt(text string, conn *connection) {
+	c.promptMu.Lock()
+	defer c.promptMu.Unlock()
+	c.promptText = text
+	c.promptConn = conn
+	c.applyPrompt()
+}
+
+// refreshPrompt redraws the prompt if it shows the health of conn.
+// It is called by the health monitor, while readline may be reading a line.
+func (c *Console) refreshPrompt(conn *connection) {
+	c.promptMu.Lock()
+	defer c.promptMu.Unlock()
+	if c.terminalReleased || conn != c.promptConn {
+		return
+	}
+	c.applyPrompt()
+	c.inst.Refresh()
+}
+
+// applyPrompt passes the prompt to readline, promptMu must be held.
+func (c *Console) applyPrompt() {
+	if c.terminalReleased {
+		return
+	}
+	health := ""
+	if c.promptConn != nil {
+		health = colorString(c.promptConn.getState().color(), "●") + " "
+	}
+	c.inst.SetPrompt(health + c.promptText)
 }
 
 func (c *Console) ensureHomeDirectoryExists() {
@@ -519,21 +1064,32 @@ func (c *Console) ensureHomeDirectoryExists() {
 }
 
 func (c *Console) updateSchema() error {
-	if c.pilosaClient == nil {
+	if c.conn == nil {
 		return errNotConnected
 	}
-	schema, err := c.pilosaClient.Schema()
-	if err != nil {
-		return err
+	return c.conn.updateSchema()
+}
+
+// lineAfterFields returns the text of line after its first n fields, keeping the spacing of the rest.
+func lineAfterFields(line string, n int) string {
+	for i := 0; i < n; i++ {
+		line = strings.TrimLeft(line, " \t\r\n")
+		end := strings.IndexAny(line, " \t\r\n")
+		if end < 0 {
+			return ""
+		}
+		line = line[end:]
 	}
-	c.schema = schema
-	return nil
+	return strings.TrimLeft(line, " \t\r\n")
 }
 
 func parseOptions(strOptions []string) (options map[string]string, err error) {
 	options = make(map[string]string, 0)
 	for _, stropt := range strOptions {
 		parts := strings.SplitN(stropt, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid option: %s. Options must be in the form name=value", stropt)
+		}
 		options[parts[0]] = parts[1]
 	}
 	return
@@ -575,6 +1131,22 @@ func makeFrameOptions(rawOptions map[string]string) (*pilosa.FrameOptions, error
 	return opts, nil
 }
 
+// parseSlices parses a comma separated list of slices, or "all".
+func parseSlices(v string) ([]uint64, error) {
+	if v == "all" {
+		return nil, nil
+	}
+	slices := []uint64{}
+	for _, part := range strings.Split(v, ",") {
+		slice, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid slice: %s", part)
+		}
+		slices = append(slices, slice)
+	}
+	return slices, nil
+}
+
 func parseBool(v string) (bool, error) {
 	switch v {
 	case "true", "t", "1":
@@ -0,0 +1,204 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+// newTestConsole returns a console without a terminal, which writes its output to out.
+func newTestConsole(out io.Writer) *Console {
+	return &Console{
+		connections:     map[string]*connection{},
+		prompt:          &promptInfo{},
+		tracer:          newTracer(),
+		stdout:          out,
+		stats:           newQueryStats(),
+		queryOptions:    &queryOptions{transport: transportJSON},
+		maxResponseSize: defaultMaxResponseSize,
+		bitLimit:        defaultBitLimit,
+		// there is no readline instance to update
+		terminalReleased: true,
+	}
+}
+
+func closeConnections(c *Console) {
+	for _, conn := range c.connections {
+		conn.close()
+	}
+}
+
+// newTestConnection returns a connection to the server at addr without retrieving its schema.
+func newTestConnection(t *testing.T, addr string) *connection {
+	uri, err := pilosa.NewURIFromAddress(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient, err := NewClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe, err := newProbeClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &connection{name: defaultConnectionName, uri: uri, httpClient: httpClient, probe: probe, tracer: newTracer()}
+}
+
+// newPilosaServer returns a server which responds to every query with the given results.
+func newPilosaServer(results string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/version":
+			w.Write([]byte(`{"version":"v0.4.0"}`))
+		case r.URL.Path == "/schema":
+			w.Write([]byte(`{"indexes":[]}`))
+		case strings.HasSuffix(r.URL.Path, "/query"):
+			w.Write([]byte(`{"results":[` + results + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestLineAfterFields(t *testing.T) {
+	tests := []struct {
+		line string
+		n    int
+		want string
+	}{
+		{":compare a,b Bitmap(frame='f', rowID=1)", 2, "Bitmap(frame='f', rowID=1)"},
+		{":compare  a,b   SetRowAttrs(frame='f', rowID=1, name='two  spaces')", 2, "SetRowAttrs(frame='f', rowID=1, name='two  spaces')"},
+		{":format template 'a\t{{.Result.Count}}   b'", 2, "'a\t{{.Result.Count}}   b'"},
+		{":compare a,b", 2, ""},
+		{":compare", 2, ""},
+	}
+	for _, test := range tests {
+		got := lineAfterFields(test.line, test.n)
+		if got != test.want {
+			t.Errorf("lineAfterFields(%q, %d) = %q, want %q", test.line, test.n, got, test.want)
+		}
+	}
+}
+
+func TestConnectionCommands(t *testing.T) {
+	a, b := newPilosaServer("1"), newPilosaServer("2")
+	defer a.Close()
+	defer b.Close()
+	out := &bytes.Buffer{}
+	c := newTestConsole(out)
+	defer closeConnections(c)
+
+	for _, line := range []string{":connect a=" + a.URL, ":connect b=" + b.URL} {
+		if err := c.executeLine(line); err != nil {
+			t.Fatalf("%s: %s", line, err)
+		}
+	}
+	if c.conn != c.connections["b"] || c.prompt.connection != "b" {
+		t.Fatalf("b should be active after connecting, got %s", c.prompt.connection)
+	}
+	if err := c.executeLine(":switch a"); err != nil {
+		t.Fatal(err)
+	}
+	if c.conn != c.connections["a"] || c.prompt.connection != "a" {
+		t.Fatalf("a should be active after :switch, got %s", c.prompt.connection)
+	}
+	if err := c.executeLine(":switch x"); err == nil || c.conn != c.connections["a"] {
+		t.Fatalf("switching to an unknown connection should fail: %v", err)
+	}
+	out.Reset()
+	if err := c.executeLine(":connections"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "* a\t") || !strings.HasPrefix(lines[1], "  b\t") {
+		t.Fatalf("unexpected connections: %q", out.String())
+	}
+}
+
+func TestExecuteOnConnection(t *testing.T) {
+	a, b := newPilosaServer("1"), newPilosaServer("2")
+	defer a.Close()
+	defer b.Close()
+	out := &bytes.Buffer{}
+	c := newTestConsole(out)
+	defer closeConnections(c)
+	c.format = formatCompact
+	for _, line := range []string{":connect b=" + b.URL, ":connect a=" + a.URL, ":use i"} {
+		if err := c.executeLine(line); err != nil {
+			t.Fatalf("%s: %s", line, err)
+		}
+	}
+	active := c.conn
+
+	tests := []struct {
+		line   string
+		output string
+		err    string
+	}{
+		{"Count(Bitmap(frame=f, rowID=1))", `{"results":[1]}`, ""},
+		{"@b Count(Bitmap(frame=f, rowID=1))", `{"results":[2]}`, ""},
+		{"@b :switch a", "", ":switch changes the active connection"},
+		{"@b :connect c=" + a.URL, "", ":connect changes the active connection"},
+		{"@x Count(Bitmap(frame=f, rowID=1))", "", "Unknown connection: x"},
+		{"@b", "", "usage: @connection-name"},
+	}
+	for _, test := range tests {
+		out.Reset()
+		err := c.executeLine(test.line)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.line, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+		} else if strings.TrimSpace(out.String()) != test.output {
+			t.Errorf("%s: got %q, want %q", test.line, out.String(), test.output)
+		}
+		if c.conn != active || c.prompt.connection != "a" {
+			t.Fatalf("%s: the active connection changed to %s", test.line, c.prompt.connection)
+		}
+	}
+	if _, ok := c.connections["c"]; ok {
+		t.Fatalf("@b :connect should not add a connection")
+	}
+}
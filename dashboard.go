@@ -0,0 +1,391 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+const (
+	dashboardKeyNone = iota
+	dashboardKeyNext
+	dashboardKeyPrevious
+	dashboardKeyRefresh
+	dashboardKeyQuit
+)
+
+var dashboardPanes = []string{"Nodes", "Indexes", "Queries", "Metrics"}
+
+// dashboardMetrics are the memstats metrics displayed on the dashboard, other memstats are skipped.
+var dashboardMetrics = map[string]bool{
+	"memstats.Alloc":     true,
+	"memstats.HeapInuse": true,
+	"memstats.NumGC":     true,
+	"memstats.Sys":       true,
+}
+
+type dashboard struct {
+	console         *Console
+	focus           int
+	panes           [][]string
+	updated         time.Time
+	previousMetrics *metricsSample
+}
+
+// dashboardUpdate holds the panes retrieved by a refresh.
+type dashboardUpdate struct {
+	panes   [][]string
+	metrics *metricsSample
+	time    time.Time
+}
+
+func (c *Console) executeDashboardCommand(cmd string, args []string) error {
+	if c.conn == nil {
+		return errNotConnected
+	}
+	if len(args) > 1 {
+		return errors.New("usage: :dashboard [interval]")
+	}
+	interval, err := parseWatchInterval(args)
+	if err != nil {
+		return err
+	}
+	fd := int(os.Stdin.Fd())
+	if !readline.IsTerminal(fd) {
+		return errors.New("The dashboard requires a terminal")
+	}
+
+	return c.releaseTerminal(func() error {
+		return c.runDashboard(fd, interval)
+	})
+}
+
+func (c *Console) runDashboard(fd int, interval time.Duration) error {
+	state, err := readline.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer readline.Restore(fd, state)
+	fmt.Print(enterAltScreen, hideCursor)
+	defer fmt.Print(showCursor, leaveAltScreen)
+
+	input := c.input.reader()
+	defer input.Close()
+	d := &dashboard{console: c}
+	return d.run(os.Stdout, input, interval, func() (int, int) {
+		width, height, err := readline.GetSize(fd)
+		if err != nil {
+			return 80, 24
+		}
+		return width, height
+	})
+}
+
+// run displays the dashboard until it is closed with a key read from in.
+// The panes are refreshed in the background, so a slow server does not hold up the keys.
+func (d *dashboard) run(w io.Writer, in io.Reader, interval time.Duration, size func() (int, int)) error {
+	keys, more := readDashboardKeys(in)
+	updates := make(chan *dashboardUpdate, 1)
+	refreshing := false
+	refresh := func() {
+		if refreshing {
+			return
+		}
+		refreshing = true
+		previous := d.previousMetrics
+		go func() {
+			updates <- d.console.collectDashboard(previous)
+		}()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	refresh()
+	for {
+		width, height := size()
+		d.render(w, width, height)
+		select {
+		case key := <-keys:
+			switch key {
+			case dashboardKeyQuit:
+				more <- false
+				return nil
+			case dashboardKeyNext:
+				d.focus = (d.focus + 1) % len(dashboardPanes)
+			case dashboardKeyPrevious:
+				d.focus = (d.focus + len(dashboardPanes) - 1) % len(dashboardPanes)
+			case dashboardKeyRefresh:
+				refresh()
+			default:
+				if key < 0 {
+					d.focus = -key - 1
+				}
+			}
+			more <- true
+		case update := <-updates:
+			refreshing = false
+			d.panes, d.previousMetrics, d.updated = update.panes, update.metrics, update.time
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// readDashboardKeys reads keys from in, which is in raw mode.
+// After each key, the reader waits on the returned channel to learn whether to read another one,
+// so no key is consumed after the dashboard is closed.
+// Pane numbers are sent as negative values.
+func readDashboardKeys(in io.Reader) (<-chan int, chan<- bool) {
+	keys := make(chan int)
+	// the reader stops after a read error, so the dashboard must not block telling it to stop
+	more := make(chan bool, 1)
+	go func() {
+		buf := make([]byte, 8)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				keys <- dashboardKeyQuit
+				return
+			}
+			key := parseDashboardKey(string(buf[:n]))
+			if key == dashboardKeyNone {
+				continue
+			}
+			keys <- key
+			if !<-more {
+				return
+			}
+		}
+	}()
+	return keys, more
+}
+
+func parseDashboardKey(input string) int {
+	switch input {
+	case "\t", "\033[C", "\033[B", "l", "j":
+		return dashboardKeyNext
+	case "\033[Z", "\033[D", "\033[A", "h", "k":
+		return dashboardKeyPrevious
+	case "r":
+		return dashboardKeyRefresh
+	case "q", "\033", "\003", "\004":
+		return dashboardKeyQuit
+	}
+	if len(input) == 1 && input[0] >= '1' && int(input[0]-'0') <= len(dashboardPanes) {
+		return -int(input[0] - '0')
+	}
+	return dashboardKeyNone
+}
+
+// collectDashboard retrieves the panes, previous is the metrics sample of the last refresh.
+// It runs in the background, so it must not change the dashboard.
+func (c *Console) collectDashboard(previous *metricsSample) *dashboardUpdate {
+	metrics, sample := dashboardMetricLines(c.conn.httpClient, previous)
+	return &dashboardUpdate{
+		panes: [][]string{
+			dashboardNodeLines(c.conn),
+			dashboardIndexLines(c.conn.httpClient),
+			dashboardQueryLines(c.stats),
+			metrics,
+		},
+		metrics: sample,
+		time:    time.Now(),
+	}
+}
+
+func dashboardNodeLines(conn *connection) []string {
+	status, err := conn.httpClient.clusterStatus()
+	if err != nil {
+		return []string{colorString(fgRed, err.Error())}
+	}
+	reachable := probeNodes(conn.probe, status.Nodes)
+	lines := []string{}
+	for _, node := range status.Nodes {
+		state := colorString(fgGreen, node.State)
+		if node.State != "UP" || !reachable[node.Host] {
+			state = colorString(fgRed, node.State)
+			if !reachable[node.Host] {
+				state = colorString(fgRed, node.State+", unreachable")
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s %s, %d indexes", node.Host, state, len(node.Indexes)))
+	}
+	return lines
+}
+
+func dashboardIndexLines(client *Client) []string {
+	maxSlices, err := client.maxSlices()
+	if err != nil {
+		return []string{colorString(fgRed, err.Error())}
+	}
+	names := make([]string, 0, len(maxSlices))
+	for name := range maxSlices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{}
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %d slices", name, maxSlices[name]+1))
+	}
+	return lines
+}
+
+func dashboardQueryLines(stats *queryStats) []string {
+	recent := stats.recent
+	lines := []string{}
+	for i := len(recent) - 1; i >= 0; i-- {
+		query := strings.Replace(recent[i].query, "\n", " ", -1)
+		lines = append(lines, fmt.Sprintf("%10s  %s", formatDuration(recent[i].elapsed), query))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No queries were run in this session")
+	}
+	return lines
+}
+
+func dashboardMetricLines(client *Client, previous *metricsSample) ([]string, *metricsSample) {
+	sample, err := client.metrics()
+	if err != nil {
+		// the rates are computed from the last successful sample
+		return []string{colorString(fgRed, err.Error())}, previous
+	}
+	keys := []string{}
+	for key, value := range sample.values {
+		if _, ok := value.(float64); !ok {
+			continue
+		}
+		if strings.HasPrefix(key, "memstats.") && !dashboardMetrics[key] {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := []string{}
+	for _, key := range keys {
+		value := sample.values[key].(float64)
+		line := fmt.Sprintf("%s = %s", key, formatNumber(value))
+		if previous != nil {
+			if previousValue, ok := previous.values[key].(float64); ok {
+				elapsed := sample.time.Sub(previous.time).Seconds()
+				if elapsed > 0 {
+					line = fmt.Sprintf("%s (%+.1f/s)", line, (value-previousValue)/elapsed)
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines, sample
+}
+
+// render draws the panes; the focused pane gets the space left from the others.
+func (d *dashboard) render(w io.Writer, width int, height int) {
+	const collapsedLines = 3
+	tabs := make([]string, len(dashboardPanes))
+	for i, name := range dashboardPanes {
+		tabs[i] = fmt.Sprintf(" %d %s ", i+1, name)
+		if i == d.focus {
+			tabs[i] = colorString(attrReverse, tabs[i])
+		}
+	}
+	updated := "loading"
+	if !d.updated.IsZero() {
+		updated = d.updated.Format("15:04:05")
+	}
+	out := []string{
+		fmt.Sprintf("%s %s  %s", colorString(attrBold, "picon"), d.console.conn.address(),
+			colorString(attrDim, updated)),
+		strings.Join(tabs, " ") + colorString(attrDim, "  tab/arrows: switch, r: refresh, q: quit"),
+	}
+	focusedLines := height - len(out) - len(dashboardPanes) - collapsedLines*(len(dashboardPanes)-1)
+	if focusedLines < collapsedLines {
+		focusedLines = collapsedLines
+	}
+	for i, name := range dashboardPanes {
+		title := colorString(fgCyan, fmt.Sprintf("── %s ", name))
+		if i == d.focus {
+			title = colorString(attrBold, fmt.Sprintf("── %s ", name))
+		}
+		out = append(out, title)
+		limit := collapsedLines
+		if i == d.focus {
+			limit = focusedLines
+		}
+		lines := []string{}
+		if i < len(d.panes) {
+			lines = d.panes[i]
+		}
+		if len(lines) > limit {
+			more := len(lines) - limit + 1
+			lines = append(lines[:limit-1:limit-1], colorString(attrDim, fmt.Sprintf("… %d more", more)))
+		}
+		for _, line := range lines {
+			out = append(out, "  "+truncateANSI(line, width-2))
+		}
+	}
+	if len(out) > height {
+		out = out[:height]
+	}
+	// the terminal is in raw mode, so lines must end with \r\n
+	fmt.Fprint(w, clearScreen, strings.Join(out, "\r\n"))
+}
+
+// truncateANSI shortens text to width visible characters, keeping color codes intact.
+func truncateANSI(text string, width int) string {
+	visible := 0
+	inEscape := false
+	for i, r := range text {
+		switch {
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+		case r == '\033':
+			inEscape = true
+		default:
+			visible++
+			if visible > width {
+				return text[:i] + string(attrReset)
+			}
+		}
+	}
+	return text
+}
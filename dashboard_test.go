@@ -0,0 +1,184 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestParseDashboardKey(t *testing.T) {
+	tests := []struct {
+		input string
+		key   int
+	}{
+		{"\t", dashboardKeyNext},
+		{"\033[C", dashboardKeyNext},
+		{"j", dashboardKeyNext},
+		{"\033[Z", dashboardKeyPrevious},
+		{"k", dashboardKeyPrevious},
+		{"r", dashboardKeyRefresh},
+		{"q", dashboardKeyQuit},
+		{"\003", dashboardKeyQuit},
+		{"1", -1},
+		{"4", -4},
+		{"5", dashboardKeyNone},
+		{"x", dashboardKeyNone},
+	}
+	for _, test := range tests {
+		if key := parseDashboardKey(test.input); key != test.key {
+			t.Errorf("parseDashboardKey(%q) = %d, want %d", test.input, key, test.key)
+		}
+	}
+}
+
+func TestReadDashboardKeysStopsAfterQuit(t *testing.T) {
+	input := newTerminalInput(iotest.OneByteReader(strings.NewReader("x2q3")))
+	reader := input.reader()
+	keys, more := readDashboardKeys(reader)
+	if key := <-keys; key != -2 {
+		t.Fatalf("got key %d, want -2", key)
+	}
+	more <- true
+	if key := <-keys; key != dashboardKeyQuit {
+		t.Fatalf("got key %d, want quit", key)
+	}
+	more <- false
+	reader.Close()
+	// the key after q is left for the next reader
+	rest, err := ioutil.ReadAll(input.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "3" {
+		t.Fatalf("got %q, want %q", rest, "3")
+	}
+}
+
+// TestDashboardKeysDuringRefresh checks that keys are handled while a refresh waits for the server.
+func TestDashboardKeysDuringRefresh(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			<-release
+			w.Write([]byte(`{"status":{"Nodes":[]}}`))
+		case "/slices/max":
+			w.Write([]byte(`{"maxSlices":{"i":2}}`))
+		case "/debug/vars":
+			w.Write([]byte(`{"uptime":3}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	c := newTestConsole(ioutil.Discard)
+	c.conn = newTestConnection(t, server.URL)
+	defer c.conn.close()
+	keys, writer := io.Pipe()
+	d := &dashboard{console: c}
+	done := make(chan error)
+	buf := &bytes.Buffer{}
+	go func() {
+		done <- d.run(buf, keys, time.Hour, func() (int, int) { return 80, 24 })
+	}()
+	writer.Write([]byte("3"))
+	writer.Write([]byte("q"))
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the dashboard did not quit while refreshing")
+	}
+	if d.focus != 2 {
+		t.Fatalf("got focus %d, want 2", d.focus)
+	}
+	if !strings.Contains(buf.String(), "loading") {
+		t.Fatalf("the dashboard was not displayed while loading:\n%s", buf.String())
+	}
+}
+
+func TestDashboardRender(t *testing.T) {
+	c := newTestConsole(ioutil.Discard)
+	c.conn = newTestConnection(t, "localhost:10101")
+	d := &dashboard{
+		console: c,
+		focus:   1,
+		panes: [][]string{
+			{"a", "b", "c", "d", "e"},
+			{"i: 3 slices", "j: 1 slices", "k: 2 slices", "l: 4 slices", "m: 8 slices"},
+			{"No queries were run in this session"},
+			{"uptime = 12345678901"},
+		},
+		updated: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	buf := &bytes.Buffer{}
+	d.render(buf, 12, 20)
+	lines := strings.Split(strings.TrimPrefix(buf.String(), clearScreen), "\r\n")
+	if len(lines) != 16 {
+		t.Fatalf("got %d lines, want 16:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	if !strings.Contains(lines[0], "03:04:05") {
+		t.Fatalf("the header does not show the update time: %q", lines[0])
+	}
+	tests := []struct {
+		line int
+		text string
+	}{
+		{2, colorString(fgCyan, "── Nodes ")},
+		{3, "  a"},
+		{5, "  " + colorString(attrDim, "… 3 more")},
+		{6, colorString(attrBold, "── Indexes ")},
+		{7, "  i: 3 slice" + string(attrReset)},
+		{11, "  m: 8 slice" + string(attrReset)},
+		{12, colorString(fgCyan, "── Queries ")},
+		{15, "  uptime = 1" + string(attrReset)},
+	}
+	for _, test := range tests {
+		if lines[test.line] != test.text {
+			t.Errorf("line %d: got %q, want %q", test.line, lines[test.line], test.text)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const diffSeparator = ";;"
+
+// executeDiffCommand compares two responses, each given as _number or a query run on the current index.
+func (c *Console) executeDiffCommand(cmd string, args []string, line string) error {
+	usage := errors.New("usage: :diff {_number | query} ;; {_number | query}, or :diff _number _number")
+	// the queries are taken as is from the line, so spaces in quoted arguments are kept
+	sides := splitDiffSides(lineAfterFields(line, 1))
+	if len(sides) == 1 && len(args) == 2 && isResponseRef(args[0]) && isResponseRef(args[1]) {
+		sides = args
+	}
+	if len(sides) != 2 {
+		return usage
+	}
+	responses := make([]*queryResponse, len(sides))
+	for i, side := range sides {
+		side = strings.TrimSpace(side)
+		if side == "" {
+			return usage
+		}
+		response, err := c.diffSide(side)
+		if err != nil {
+			return fmt.Errorf("%s: %s", side, err)
+		}
+		responses[i] = response
+	}
+	fmt.Fprint(c.stdout, renderDiff(responses[0], responses[1], c.bitLimit))
+	return nil
+}
+
+// splitDiffSides splits the arguments of :diff on ;; outside of quotes and brackets.
+func splitDiffSides(text string) []string {
+	sides := []string{}
+	start, offset := 0, 0
+	for {
+		i := indexTopLevel(text[offset:], ";")
+		if i < 0 {
+			return append(sides, text[start:])
+		}
+		i += offset
+		offset = i + 1
+		if strings.HasPrefix(text[i:], diffSeparator) {
+			sides = append(sides, text[start:i])
+			start = i + len(diffSeparator)
+			offset = start
+		}
+	}
+}
+
+// diffSide returns the saved response for _number, otherwise runs the query.
+func (c *Console) diffSide(side string) (*queryResponse, error) {
+	if isResponseRef(side) {
+		saved, err := c.findResponse(side)
+		if err != nil {
+			return nil, err
+		}
+		return saved.queryResponse()
+	}
+	if c.conn == nil {
+		return nil, errNotConnected
+	}
+	if c.index == nil {
+		return nil, errNoIndex
+	}
+	response, err := c.conn.httpClient.query(c.index.Name(), side, c.queryOptions)
+	if err != nil {
+		return nil, err
+	}
+	decoded := response.decode(side)
+	c.saveResponse(decoded)
+	return decoded.queryResponse()
+}
+
+func renderDiff(a *queryResponse, b *queryResponse, bitLimit int) string {
+	buf := &bytes.Buffer{}
+	if len(a.results) != len(b.results) {
+		fmt.Fprintf(buf, "A has %d results, B has %d results\n", len(a.results), len(b.results))
+	}
+	same := len(a.results) == len(b.results)
+	for i := 0; i < len(a.results) && i < len(b.results); i++ {
+		ra, rb := a.results[i], b.results[i]
+		if ra.equal(rb) {
+			continue
+		}
+		same = false
+		name := ra.call
+		if name == "" {
+			name = ra.kind.String()
+		}
+		fmt.Fprintln(buf, colorString(attrBold, fmt.Sprintf("Result %d (%s)", i, name)))
+		if ra.kind != rb.kind {
+			fmt.Fprintf(buf, "A is %s, B is %s\n", ra.kind, rb.kind)
+			continue
+		}
+		switch ra.kind {
+		case resultBitmap:
+			diffBits(buf, ra.bitmap.Bits, rb.bitmap.Bits, bitLimit)
+			diffAttrs(buf, "", ra.bitmap.Attrs, rb.bitmap.Attrs)
+		case resultTopN:
+			diffPairs(buf, ra.pairs, rb.pairs)
+		case resultCount:
+			fmt.Fprintf(buf, "A: %s, B: %s (%s)\n", formatThousands(ra.count), formatThousands(rb.count),
+				formatDelta(int64(rb.count)-int64(ra.count)))
+		case resultChanged:
+			fmt.Fprintf(buf, "A: %t, B: %t\n", ra.changed, rb.changed)
+		}
+	}
+	if !diffColumnAttrs(buf, a.columnAttrs, b.columnAttrs) {
+		same = false
+	}
+	if same {
+		return colorString(fgGreen, "The results are the same") + "\n"
+	}
+	return buf.String()
+}
+
+// diffBits displays the bits only in a, only in b, and the number of bits in both.
+func diffBits(buf *bytes.Buffer, a []uint64, b []uint64, limit int) {
+	a, b = sortedBits(a), sortedBits(b)
+	onlyA, onlyB := []uint64{}, []uint64{}
+	both := 0
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || i < len(a) && a[i] < b[j]:
+			onlyA = append(onlyA, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			onlyB = append(onlyB, b[j])
+			j++
+		default:
+			both++
+			i++
+			j++
+		}
+	}
+	fmt.Fprintf(buf, "Only in A: %s\n", colorString(fgRed, formatBitList(onlyA, limit)))
+	fmt.Fprintf(buf, "Only in B: %s\n", colorString(fgGreen, formatBitList(onlyB, limit)))
+	fmt.Fprintf(buf, "In both: %s\n", formatBitCount(both))
+}
+
+func sortedBits(bits []uint64) []uint64 {
+	sorted := append([]uint64{}, bits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func formatBitCount(n int) string {
+	if n == 1 {
+		return "1 bit"
+	}
+	return formatThousands(uint64(n)) + " bits"
+}
+
+func formatBitList(bits []uint64, limit int) string {
+	text := formatBitCount(len(bits))
+	if len(bits) == 0 {
+		return text
+	}
+	shown := bits
+	if limit > 0 && len(bits) > limit {
+		shown = bits[:limit]
+	}
+	parts := make([]string, len(shown))
+	for i, bit := range shown {
+		parts[i] = strconv.FormatUint(bit, 10)
+	}
+	text += ": " + strings.Join(parts, " ")
+	if len(shown) < len(bits) {
+		text += fmt.Sprintf(" … %s more", formatThousands(uint64(len(bits)-len(shown))))
+	}
+	return text
+}
+
+// diffAttrs displays the keys whose values differ, prefix names the column the attributes belong to.
+func diffAttrs(buf *bytes.Buffer, prefix string, a map[string]interface{}, b map[string]interface{}) bool {
+	keySet := map[string]bool{}
+	for key := range a {
+		keySet[key] = true
+	}
+	for key := range b {
+		keySet[key] = true
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	same := true
+	for _, key := range keys {
+		va, okA := a[key]
+		vb, okB := b[key]
+		if okA && okB && fmt.Sprint(va) == fmt.Sprint(vb) {
+			continue
+		}
+		same = false
+		fmt.Fprintf(buf, "%sAttribute %s: %s → %s\n", prefix, key, formatAttrValue(va, okA), formatAttrValue(vb, okB))
+	}
+	return same
+}
+
+func formatAttrValue(value interface{}, ok bool) string {
+	if !ok {
+		return colorString(attrDim, "(none)")
+	}
+	return formatScalar(value)
+}
+
+// diffColumnAttrs displays the column attributes which differ. It returns true if there is no difference.
+func diffColumnAttrs(buf *bytes.Buffer, a []columnAttrSet, b []columnAttrSet) bool {
+	attrsA, attrsB := map[uint64]map[string]interface{}{}, map[uint64]map[string]interface{}{}
+	ids := []uint64{}
+	for _, set := range a {
+		attrsA[set.ID] = set.Attrs
+		ids = append(ids, set.ID)
+	}
+	for _, set := range b {
+		if _, ok := attrsA[set.ID]; !ok {
+			ids = append(ids, set.ID)
+		}
+		attrsB[set.ID] = set.Attrs
+	}
+	ids = sortedBits(ids)
+	diff := &bytes.Buffer{}
+	for _, id := range ids {
+		diffAttrs(diff, fmt.Sprintf("Column %d: ", id), attrsA[id], attrsB[id])
+	}
+	if diff.Len() == 0 {
+		return true
+	}
+	fmt.Fprintln(buf, colorString(attrBold, "Column attributes"))
+	buf.Write(diff.Bytes())
+	return false
+}
+
+// diffPairs displays the TopN pairs whose rank or count changed.
+func diffPairs(buf *bytes.Buffer, a []pairResult, b []pairResult) {
+	type ranked struct {
+		rank  int
+		count uint64
+	}
+	rankedA, rankedB := map[string]ranked{}, map[string]ranked{}
+	ids := []string{}
+	for i, pair := range a {
+		id := pairID(pair)
+		rankedA[id] = ranked{rank: i + 1, count: pair.Count}
+		ids = append(ids, id)
+	}
+	for i, pair := range b {
+		id := pairID(pair)
+		if _, ok := rankedA[id]; !ok {
+			ids = append(ids, id)
+		}
+		rankedB[id] = ranked{rank: i + 1, count: pair.Count}
+	}
+	rows := [][]string{}
+	unchanged := 0
+	for _, id := range ids {
+		pa, okA := rankedA[id]
+		pb, okB := rankedB[id]
+		if okA && okB && pa == pb {
+			unchanged++
+			continue
+		}
+		row := []string{id, "", "", "", "", ""}
+		if okA {
+			row[1] = strconv.Itoa(pa.rank)
+			row[3] = formatThousands(pa.count)
+		}
+		if okB {
+			row[2] = strconv.Itoa(pb.rank)
+			row[4] = formatThousands(pb.count)
+		}
+		switch {
+		case !okA:
+			row[5] = "new"
+		case !okB:
+			row[5] = "gone"
+		default:
+			row[5] = formatDelta(int64(pb.count) - int64(pa.count))
+		}
+		rows = append(rows, row)
+	}
+	renderRows(buf, []string{"ID", "Rank A", "Rank B", "Count A", "Count B", "Delta"}, rows,
+		[]bool{true, true, true, true, true, true}, screenWidth())
+	if unchanged > 0 {
+		fmt.Fprintln(buf, colorString(attrDim, fmt.Sprintf("%d pairs unchanged", unchanged)))
+	}
+}
+
+func pairID(pair pairResult) string {
+	if pair.Key != "" {
+		return pair.Key
+	}
+	return strconv.FormatUint(pair.ID, 10)
+}
+
+func formatDelta(delta int64) string {
+	if delta > 0 {
+		return "+" + formatThousands(uint64(delta))
+	}
+	if delta < 0 {
+		return "-" + formatThousands(uint64(-delta))
+	}
+	return "0"
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestSplitDiffSides(t *testing.T) {
+	tests := []struct {
+		text  string
+		sides []string
+	}{
+		{"_1 _2", []string{"_1 _2"}},
+		{"_1 ;; _2", []string{"_1 ", " _2"}},
+		{"Bitmap(frame='f', rowID=1);;Bitmap(frame='g', rowID=1)", []string{"Bitmap(frame='f', rowID=1)", "Bitmap(frame='g', rowID=1)"}},
+		{`SetRowAttrs(frame="f", rowID=1, note=";;") ;; _3`, []string{`SetRowAttrs(frame="f", rowID=1, note=";;") `, " _3"}},
+		{"a ; b ;; c", []string{"a ; b ", " c"}},
+		{"a ;; b ;; c", []string{"a ", " b ", " c"}},
+	}
+	for _, test := range tests {
+		if got := splitDiffSides(test.text); !reflect.DeepEqual(got, test.sides) {
+			t.Errorf("%s: got %q, expected %q", test.text, got, test.sides)
+		}
+	}
+}
+
+func TestDiffSavedResponses(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := &Console{stdout: buf}
+	c.saveResponse(newDecodedResponse([]byte(`{"results":[{"attrs":{},"bits":[1,2,3]}]}`), "Bitmap(frame=f, rowID=1)"))
+	c.saveResponse(newDecodedResponse([]byte(`{"results":[{"attrs":{},"bits":[2,3,4]}]}`), "Bitmap(frame=f, rowID=2)"))
+	err := c.executeDiffCommand(":diff", []string{"_1", "_2"}, ":diff _1 _2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &bytes.Buffer{}
+	diffBits(expected, []uint64{1, 2, 3}, []uint64{2, 3, 4}, 0)
+	if text := buf.String(); !strings.HasPrefix(text, colorString(attrBold, "Result 0 (Bitmap)")) ||
+		!strings.HasSuffix(text, expected.String()) {
+		t.Fatalf("got\n%s", text)
+	}
+	for _, line := range []string{":diff _1", ":diff _1 ;;", ":diff ;; _2", ":diff _1 _2 _3"} {
+		if err := c.executeDiffCommand(":diff", strings.Fields(line)[1:], line); err == nil || !strings.HasPrefix(err.Error(), "usage:") {
+			t.Errorf("%s: expected the usage, got %v", line, err)
+		}
+	}
+}
+
+func TestDiffTopN(t *testing.T) {
+	query := "TopN(frame=f, n=3)"
+	a := newDecodedResponse([]byte(`{"results":[[{"id":1,"count":10},{"id":2,"count":5},{"id":3,"count":1}]]}`), query)
+	b := newDecodedResponse([]byte(`{"results":[[{"id":2,"count":1200},{"id":1,"count":10},{"id":4,"count":2}]]}`), query)
+	got := renderDiff(a.decoded, b.decoded, 0)
+	// without a terminal the table is rendered 80 columns wide, so no cell is truncated
+	expected := &bytes.Buffer{}
+	renderRows(expected, []string{"ID", "Rank A", "Rank B", "Count A", "Count B", "Delta"}, [][]string{
+		{"1", "1", "2", "10", "10", "0"},
+		{"2", "2", "1", "5", "1,200", "+1,195"},
+		{"3", "3", "", "1", "", "gone"},
+		{"4", "", "3", "", "2", "new"},
+	}, []bool{true, true, true, true, true, true}, 80)
+	if want := colorString(attrBold, "Result 0 (TopN)") + "\n" + expected.String(); got != want {
+		t.Fatalf("got\n%s\nexpected\n%s", got, want)
+	}
+
+	b = newDecodedResponse([]byte(`{"results":[[{"id":1,"count":10},{"id":2,"count":6},{"id":3,"count":1}]]}`), query)
+	lines := strings.Split(strings.TrimSpace(renderDiff(a.decoded, b.decoded, 0)), "\n")
+	if len(lines) != 5 || !strings.HasSuffix(lines[3], "+1") || lines[4] != colorString(attrDim, "2 pairs unchanged") {
+		t.Fatalf("got %q", lines)
+	}
+}
+
+func TestDiffKeepsQuerySpacing(t *testing.T) {
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		queries = append(queries, string(body))
+		w.Write([]byte(`{"results":[null]}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := pilosa.NewIndex("i", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Console{
+		stdout:       &bytes.Buffer{},
+		conn:         &connection{httpClient: client},
+		index:        index,
+		queryOptions: &queryOptions{},
+	}
+	first := `SetRowAttrs(frame='f', rowID=1, note='two  spaces;;')`
+	second := `SetRowAttrs(frame='f', rowID=2, note="tab	here")`
+	line := ":diff  " + first + " ;; " + second
+	err = c.executeDiffCommand(":diff", strings.Fields(line)[1:], line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(queries, []string{first, second}) {
+		t.Fatalf("got %q", queries)
+	}
+}
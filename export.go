@@ -0,0 +1,298 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type exportFormat int
+
+const (
+	exportJSON exportFormat = iota
+	exportCSV
+	exportIDs
+)
+
+var exportFormats = map[string]exportFormat{
+	"json": exportJSON,
+	"csv":  exportCSV,
+	"ids":  exportIDs,
+}
+
+// redirect is the file the output of a line is written to instead of the terminal.
+type redirect struct {
+	path   string
+	append bool
+	format exportFormat
+}
+
+func (c *Console) executeExportCommand(cmd string, args []string) error {
+	ref := "_"
+	if len(args) > 0 && isResponseRef(args[0]) {
+		ref = args[0]
+		args = args[1:]
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: :export [_number] file [json | csv | ids]")
+	}
+	response, err := c.findResponse(ref)
+	if err != nil {
+		return err
+	}
+	target := &redirect{
+		path:   args[0],
+		format: exportFormatForPath(args[0]),
+	}
+	if len(args) == 2 {
+		format, ok := exportFormats[args[1]]
+		if !ok {
+			return fmt.Errorf("Invalid export format: %s. Try one of json, csv or ids", args[1])
+		}
+		target.format = format
+	}
+	return target.write(response.decodedResponse)
+}
+
+// exportFormatForPath returns the export format for the extension of the file,
+// files other than .csv and .ids get the response as is.
+func exportFormatForPath(path string) exportFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return exportCSV
+	case ".ids":
+		return exportIDs
+	}
+	return exportJSON
+}
+
+func (r *redirect) write(response *decodedResponse) error {
+	data, err := renderExport(response, r.format)
+	if err != nil {
+		return err
+	}
+	f, err := r.open()
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(colorString(attrDim, fmt.Sprintf("Wrote %s to %s", formatByteSize(len(data)), r.path)))
+	return nil
+}
+
+// open opens the file for writing, it is truncated unless the output is appended.
+func (r *redirect) open() (*os.File, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if r.append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	return os.OpenFile(r.path, flags, 0644)
+}
+
+func renderExport(response *decodedResponse, format exportFormat) ([]byte, error) {
+	body := response.jsonBody()
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, errors.New("The response is empty")
+	}
+	switch format {
+	case exportCSV:
+		if response.decoded != nil {
+			return []byte(exportQueryCSV(response.decoded) + "\n"), nil
+		}
+		if value, err := decodeJSON(body); err == nil {
+			if text, ok := renderValueCSV(value); ok {
+				return []byte(text), nil
+			}
+		}
+		return nil, errors.New("Only query responses, objects and lists can be exported as CSV")
+	case exportIDs:
+		if response.decoded != nil {
+			return exportQueryIDs(response.decoded), nil
+		}
+		if data, ok := exportValueIDs(body); ok {
+			return data, nil
+		}
+		return nil, errors.New("Only query responses and lists of values can be exported as IDs")
+	}
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		body = append(body[:len(body):len(body)], '\n')
+	}
+	return body, nil
+}
+
+// exportQueryIDs writes one column ID per line for bitmaps and one row ID per line for TopN results.
+func exportQueryIDs(response *queryResponse) []byte {
+	buf := &bytes.Buffer{}
+	for _, result := range response.results {
+		switch result.kind {
+		case resultBitmap:
+			for _, bit := range result.bitmap.Bits {
+				buf.WriteString(strconv.FormatUint(bit, 10))
+				buf.WriteByte('\n')
+			}
+		case resultTopN:
+			for _, pair := range result.pairs {
+				if pair.Key != "" {
+					buf.WriteString(pair.Key)
+				} else {
+					buf.WriteString(strconv.FormatUint(pair.ID, 10))
+				}
+				buf.WriteByte('\n')
+			}
+		case resultCount:
+			fmt.Fprintln(buf, result.count)
+		case resultChanged:
+			fmt.Fprintln(buf, result.changed)
+		}
+	}
+	return buf.Bytes()
+}
+
+// exportValueIDs writes each item of a list of numbers or strings on a line, e.g. the result of a path filter.
+func exportValueIDs(body []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if decoder.Decode(&value) != nil {
+		return nil, false
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+	buf := &bytes.Buffer{}
+	for _, item := range items {
+		switch v := item.(type) {
+		case json.Number:
+			buf.WriteString(string(v))
+		case string:
+			buf.WriteString(v)
+		default:
+			return nil, false
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), true
+}
+
+// exportQueryCSV renders the results as CSV. If column attributes were requested,
+// they are added as columns to the bits of bitmaps.
+func exportQueryCSV(response *queryResponse) string {
+	if len(response.columnAttrs) == 0 {
+		return renderQueryCSV(response)
+	}
+	attrs := map[uint64]map[string]interface{}{}
+	keySet := map[string]bool{}
+	for _, set := range response.columnAttrs {
+		attrs[set.ID] = set.Attrs
+		for key := range set.Attrs {
+			keySet[key] = true
+		}
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sections := make([]string, len(response.results))
+	for i, result := range response.results {
+		if result.kind != resultBitmap {
+			sections[i] = renderQueryCSV(&queryResponse{results: []*queryResult{result}})
+			continue
+		}
+		rows := make([]interface{}, len(result.bitmap.Bits))
+		for j, bit := range result.bitmap.Bits {
+			row := map[string]interface{}{"id": bit}
+			for key, value := range attrs[bit] {
+				row[key] = value
+			}
+			for _, key := range keys {
+				if _, ok := row[key]; !ok {
+					row[key] = nil
+				}
+			}
+			rows[j] = row
+		}
+		text, _ := renderValueCSV(rows)
+		sections[i] = strings.TrimRight(text, "\n")
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// splitRedirect splits a line ending with > file or >> file. > characters in quotes
+// or brackets are not redirections.
+func splitRedirect(line string) (string, *redirect, error) {
+	i := indexTopLevel(line, ">")
+	if i < 0 {
+		return line, nil, nil
+	}
+	target := &redirect{}
+	path := line[i+1:]
+	if strings.HasPrefix(path, ">") {
+		target.append = true
+		path = path[1:]
+	}
+	target.path = strings.TrimSpace(path)
+	if target.path == "" || strings.ContainsAny(target.path, "<>") {
+		return "", nil, errors.New("usage: query > file or query >> file")
+	}
+	target.format = exportFormatForPath(target.path)
+	return strings.TrimSpace(line[:i]), target, nil
+}
+
+// canRedirect returns true for lines whose output can be redirected: queries, _ and :http.
+func canRedirect(line string) bool {
+	if strings.HasPrefix(line, "#") {
+		return false
+	}
+	if strings.HasPrefix(line, ":") {
+		return strings.Fields(line)[0] == ":http"
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportFormatForPath(t *testing.T) {
+	tests := map[string]exportFormat{
+		"bits.ids":          exportIDs,
+		"BITS.IDS":          exportIDs,
+		"top.csv":           exportCSV,
+		"response.json":     exportJSON,
+		"status.txt":        exportJSON,
+		"response":          exportJSON,
+		"dir.csv/top.txt":   exportJSON,
+		"/tmp/results.Csv":  exportCSV,
+		"./archive.ids.bak": exportJSON,
+	}
+	for path, expected := range tests {
+		if got := exportFormatForPath(path); got != expected {
+			t.Errorf("%s: got %d, expected %d", path, got, expected)
+		}
+	}
+}
+
+func TestSplitRedirect(t *testing.T) {
+	tests := []struct {
+		line     string
+		rest     string
+		redirect *redirect
+	}{
+		{"Bitmap(frame='f', rowID=1)", "Bitmap(frame='f', rowID=1)", nil},
+		{"Bitmap(frame='f', rowID=1) > bits.ids", "Bitmap(frame='f', rowID=1)", &redirect{path: "bits.ids", format: exportIDs}},
+		{"TopN(frame='f') >> top.csv", "TopN(frame='f')", &redirect{path: "top.csv", append: true, format: exportCSV}},
+		{"Range(frame='f', start='>') > r.json", "Range(frame='f', start='>')", &redirect{path: "r.json", format: exportJSON}},
+		{`SetRowAttrs(frame="f", rowID=1, note="a > b")`, `SetRowAttrs(frame="f", rowID=1, note="a > b")`, nil},
+		{"_ .results[?(.count > 1)] > out.txt", "_ .results[?(.count > 1)]", &redirect{path: "out.txt", format: exportJSON}},
+		{":http get /status > status.txt", ":http get /status", &redirect{path: "status.txt", format: exportJSON}},
+	}
+	for _, test := range tests {
+		rest, target, err := splitRedirect(test.line)
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+			continue
+		}
+		if rest != test.rest || !reflect.DeepEqual(target, test.redirect) {
+			t.Errorf("%s: got %q, %+v", test.line, rest, target)
+		}
+	}
+	for _, line := range []string{"Count() >", "Count() > ", "Count() > a > b", "Count() >>> a"} {
+		if _, _, err := splitRedirect(line); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestRenderExport(t *testing.T) {
+	topN := []byte(`{"results":[[{"id":5,"count":10},{"key":"k","count":2}]]}`)
+	tests := []struct {
+		body     []byte
+		query    string
+		format   exportFormat
+		expected string
+	}{
+		{topN, "TopN(frame=f)", exportIDs, "5\nk\n"},
+		{topN, "TopN(frame=f)", exportCSV, "id,count\n5,10\nk,2\n"},
+		{topN, "TopN(frame=f)", exportJSON, string(topN) + "\n"},
+		{[]byte(`{"results":[{"attrs":{},"bits":[1,18446744073709551615]}]}`), "Bitmap(frame=f, rowID=1)", exportIDs, "1\n18446744073709551615\n"},
+		{[]byte(`[1, "a"]`), "", exportIDs, "1\na\n"},
+		{[]byte(`{"state":"NORMAL"}`), "", exportCSV, "key,value\nstate,NORMAL\n"},
+		{[]byte(`{"state":"NORMAL"}` + "\n"), "", exportJSON, `{"state":"NORMAL"}` + "\n"},
+	}
+	for _, test := range tests {
+		data, err := renderExport(newDecodedResponse(test.body, test.query), test.format)
+		if err != nil {
+			t.Errorf("%s: %s", test.body, err)
+			continue
+		}
+		if string(data) != test.expected {
+			t.Errorf("%s: got %q, expected %q", test.body, data, test.expected)
+		}
+	}
+}
+
+func TestRenderExportErrors(t *testing.T) {
+	tests := []struct {
+		body   string
+		format exportFormat
+	}{
+		{`{"state":"NORMAL","nodes":[]}`, exportIDs},
+		{`not json`, exportCSV},
+		{`not json`, exportIDs},
+		{"", exportJSON},
+		{" \n", exportIDs},
+	}
+	for _, test := range tests {
+		data, err := renderExport(newDecodedResponse([]byte(test.body), ""), test.format)
+		if err == nil {
+			t.Errorf("%q, %d: expected an error, got %q", test.body, test.format, data)
+		} else if !strings.HasPrefix(err.Error(), "Only") && !strings.HasPrefix(err.Error(), "The response") {
+			t.Errorf("%q: unexpected error: %s", test.body, err)
+		}
+	}
+}
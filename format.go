@@ -0,0 +1,444 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type outputFormat int
+
+const (
+	formatJSON outputFormat = iota
+	formatCompact
+	formatTable
+	formatCSV
+	formatYAML
+	formatRaw
+	formatTemplate
+)
+
+var outputFormats = map[string]outputFormat{
+	"json":    formatJSON,
+	"compact": formatCompact,
+	"table":   formatTable,
+	"csv":     formatCSV,
+	"yaml":    formatYAML,
+	"raw":     formatRaw,
+	// the template format is set with :format template
+}
+
+func parseOutputFormat(name string) (outputFormat, error) {
+	format, ok := outputFormats[name]
+	if !ok {
+		return formatJSON, fmt.Errorf("Invalid format: %s. Try one of json, compact, table, csv, yaml or raw", name)
+	}
+	return format, nil
+}
+
+func (f outputFormat) String() string {
+	if f == formatTemplate {
+		return "template"
+	}
+	for name, format := range outputFormats {
+		if format == f {
+			return name
+		}
+	}
+	return "json"
+}
+
+// formatResponse renders a response in the given format. Query responses are rendered per result
+// in table and CSV formats, other JSON responses are rendered generically.
+// Responses which are not JSON are returned as is. summaries describe the bitmaps truncated in the response.
+func formatResponse(format outputFormat, response *decodedResponse, summaries []bitmapSummary) string {
+	body := response.jsonBody()
+	if format == formatRaw {
+		return string(body)
+	}
+	var value interface{}
+	if response.decoded != nil {
+		value = response.decoded.value()
+	} else {
+		var err error
+		value, err = decodeJSON(body)
+		if err != nil {
+			return string(body)
+		}
+	}
+	switch format {
+	case formatCompact:
+		buf := &bytes.Buffer{}
+		if err := json.Compact(buf, body); err == nil {
+			return buf.String()
+		}
+	case formatTable:
+		if response.decoded != nil {
+			return renderTable(response.decoded, summaries)
+		}
+		if text, ok := renderValueTable(value); ok {
+			return text
+		}
+	case formatCSV:
+		if response.decoded != nil {
+			return renderQueryCSV(response.decoded)
+		}
+		if text, ok := renderValueCSV(value); ok {
+			return strings.TrimRight(text, "\n")
+		}
+	case formatYAML:
+		buf := &bytes.Buffer{}
+		writeYAML(buf, value, 0)
+		return strings.TrimRight(buf.String(), "\n")
+	}
+	return prettyJSON(value)
+}
+
+// decodeJSON decodes a JSON document. Numbers are kept as json.Number so IDs don't lose precision.
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("Invalid JSON: data after the document")
+	}
+	return value, nil
+}
+
+func renderQueryCSV(response *queryResponse) string {
+	buf := &bytes.Buffer{}
+	for i, result := range response.results {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		writer := csv.NewWriter(buf)
+		switch result.kind {
+		case resultBitmap:
+			writer.Write([]string{"bit"})
+			for _, bit := range result.bitmap.Bits {
+				writer.Write([]string{strconv.FormatUint(bit, 10)})
+			}
+		case resultTopN:
+			writer.Write([]string{"id", "count"})
+			for _, pair := range result.pairs {
+				id := strconv.FormatUint(pair.ID, 10)
+				if pair.Key != "" {
+					id = pair.Key
+				}
+				writer.Write([]string{id, strconv.FormatUint(pair.Count, 10)})
+			}
+		case resultCount:
+			writer.Write([]string{"count"})
+			writer.Write([]string{strconv.FormatUint(result.count, 10)})
+		case resultChanged:
+			writer.Write([]string{"changed"})
+			writer.Write([]string{strconv.FormatBool(result.changed)})
+		}
+		writer.Flush()
+	}
+	if len(response.columnAttrs) > 0 {
+		buf.WriteString("\n")
+		rows := make([]interface{}, len(response.columnAttrs))
+		for i, set := range response.columnAttrs {
+			row := map[string]interface{}{"id": set.ID}
+			for key, value := range set.Attrs {
+				row[key] = value
+			}
+			rows[i] = row
+		}
+		text, _ := renderValueCSV(rows)
+		buf.WriteString(text)
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// renderValueCSV renders a JSON value other than a query response as CSV: an array of objects
+// with the union of the keys as the header, an object as keys and values, an array of scalars as a column.
+func renderValueCSV(value interface{}) (string, bool) {
+	headers, rows, ok := valueRows(value)
+	if !ok {
+		return "", false
+	}
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	writer.Write(headers)
+	writer.WriteAll(rows)
+	return buf.String(), true
+}
+
+// valueRows converts a JSON value to the header and rows of a table, see renderValueCSV.
+func valueRows(value interface{}) ([]string, [][]string, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		rows := make([][]string, len(keys))
+		for i, key := range keys {
+			rows[i] = []string{key, formatCell(v[key])}
+		}
+		return []string{"key", "value"}, rows, true
+	case []interface{}:
+		keys, ok := objectKeys(v)
+		if !ok {
+			rows := make([][]string, len(v))
+			for i, item := range v {
+				if !isYAMLScalar(item) {
+					return nil, nil, false
+				}
+				rows[i] = []string{formatCell(item)}
+			}
+			return []string{"value"}, rows, true
+		}
+		rows := make([][]string, len(v))
+		for i, item := range v {
+			object := item.(map[string]interface{})
+			row := make([]string, len(keys))
+			for j, key := range keys {
+				row[j] = formatCell(object[key])
+			}
+			rows[i] = row
+		}
+		return keys, rows, true
+	}
+	return nil, nil, false
+}
+
+// objectKeys returns the sorted union of the keys if all items are objects.
+func objectKeys(items []interface{}) ([]string, bool) {
+	if len(items) == 0 {
+		return nil, false
+	}
+	keySet := map[string]bool{}
+	for _, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		for key := range object {
+			keySet[key] = true
+		}
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, true
+}
+
+// formatCell formats a value for a table cell, missing and null values are empty.
+func formatCell(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return formatScalar(value)
+}
+
+func formatScalar(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+func writeYAML(buf *bytes.Buffer, value interface{}, indent int) {
+	prefix := strings.Repeat("  ", indent)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			fmt.Fprintf(buf, "%s{}\n", prefix)
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if isYAMLScalar(v[key]) {
+				fmt.Fprintf(buf, "%s%s: %s\n", prefix, yamlString(key), yamlScalar(v[key]))
+			} else {
+				fmt.Fprintf(buf, "%s%s:\n", prefix, yamlString(key))
+				writeYAML(buf, v[key], indent+1)
+			}
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			fmt.Fprintf(buf, "%s[]\n", prefix)
+			return
+		}
+		for _, item := range v {
+			if isYAMLScalar(item) {
+				fmt.Fprintf(buf, "%s- %s\n", prefix, yamlScalar(item))
+				continue
+			}
+			// render the item one level deeper, then put the dash on its first line
+			inner := &bytes.Buffer{}
+			writeYAML(inner, item, indent+1)
+			text := inner.String()
+			fmt.Fprintf(buf, "%s- %s", prefix, strings.TrimPrefix(text, prefix+"  "))
+		}
+	default:
+		fmt.Fprintf(buf, "%s%s\n", prefix, yamlScalar(v))
+	}
+}
+
+func isYAMLScalar(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return true
+}
+
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return yamlString(v)
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	return formatScalar(value)
+}
+
+// yamlString quotes strings which would otherwise be read as another type or break the syntax.
+func yamlString(s string) string {
+	switch strings.ToLower(s) {
+	case "", "null", "~", "true", "false", "yes", "no", "on", "off":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	if strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n\t") || strings.TrimSpace(s) != s || strings.HasPrefix(s, "-") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// JSON colors, the same as those of go-prettyjson which was used before.
+const (
+	jsonKeyColor    = fgBlue + attrBold
+	jsonStringColor = fgGreen + attrBold
+	jsonBoolColor   = fgYellow + attrBold
+	jsonNumberColor = fgCyan + attrBold
+	jsonNullColor   = fgBlack + attrBold
+)
+
+// prettyJSON renders a value decoded by decodeJSON as colored and indented JSON with sorted keys.
+// Numbers are written as they were received, so IDs above 2^53 keep their precision.
+func prettyJSON(value interface{}) string {
+	buf := &bytes.Buffer{}
+	writeJSON(buf, value, 0)
+	return buf.String()
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}, indent int) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for i, key := range sortedKeys(v) {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteString(strings.Repeat("  ", indent+1))
+			buf.WriteString(colorString(jsonKeyColor, jsonString(key)))
+			buf.WriteString(": ")
+			writeJSON(buf, v[key], indent+1)
+		}
+		buf.WriteString("\n" + strings.Repeat("  ", indent) + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[\n")
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteString(strings.Repeat("  ", indent+1))
+			writeJSON(buf, item, indent+1)
+		}
+		buf.WriteString("\n" + strings.Repeat("  ", indent) + "]")
+	case string:
+		buf.WriteString(colorString(jsonStringColor, jsonString(v)))
+	case bool:
+		buf.WriteString(colorString(jsonBoolColor, strconv.FormatBool(v)))
+	case nil:
+		buf.WriteString(colorString(jsonNullColor, "null"))
+	case json.Number:
+		buf.WriteString(colorString(jsonNumberColor, v.String()))
+	default:
+		// values which were not decoded by decodeJSON, e.g. float64
+		data, _ := json.Marshal(v)
+		buf.WriteString(colorString(jsonNumberColor, string(data)))
+	}
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
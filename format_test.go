@@ -0,0 +1,199 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeQueryResponseRequiresResults(t *testing.T) {
+	for _, body := range []string{`{}`, `{"results": null}`, `{"nodes": []}`, `[]`} {
+		if _, err := decodeQueryResponse([]byte(body), ""); err == nil {
+			t.Errorf("%s: expected an error", body)
+		}
+	}
+	response, err := decodeQueryResponse([]byte(`{"results": []}`), "")
+	if err != nil || len(response.results) != 0 {
+		t.Fatalf("empty results: %v, %v", response, err)
+	}
+	if _, err := decodeQueryResponse([]byte(`{"error": "index not found"}`), ""); err == nil || err.Error() != "index not found" {
+		t.Fatalf("expected the error of the response, got %v", err)
+	}
+}
+
+func TestDecodedResponseEncoding(t *testing.T) {
+	tests := []string{
+		`{"results":[{"attrs":{"n":18446744073709551615,"f":1.5},"bits":[1,9007199254740993]}]}`,
+		`{"results":[3,true,null,[{"id":5,"count":10},{"id":0,"key":"k","count":2}]]}`,
+		`{"results":[],"columnAttrs":[{"id":7,"attrs":{"x":"y"}}]}`,
+	}
+	for _, body := range tests {
+		response := newDecodedResponse([]byte(body), "")
+		if response.decoded == nil {
+			t.Fatalf("%s: not decoded", body)
+		}
+		// a response without its body, e.g. a truncated one, is encoded from the decoded response
+		encoded := &decodedResponse{decoded: response.decoded}
+		value, err := decodeJSON(encoded.jsonBody())
+		if err != nil {
+			t.Fatalf("%s: %s", body, err)
+		}
+		original, _ := decodeJSON([]byte(body))
+		if !reflect.DeepEqual(value, original) {
+			t.Errorf("%s: encoded as %s", body, encoded.jsonBody())
+		}
+		if !reflect.DeepEqual(response.decoded.value(), original) {
+			t.Errorf("%s: got value %v", body, response.decoded.value())
+		}
+	}
+}
+
+func TestFormatResponseCSV(t *testing.T) {
+	tests := []struct {
+		body     string
+		query    string
+		expected string
+	}{
+		{`{"results": [{"attrs": {}, "bits": [1, 2]}, 3]}`, "Bitmap(frame=f, rowID=1) Count()", "bit\n1\n2\n\ncount\n3"},
+		{`[{"id": 18446744073709551615, "name": "a"}, {"id": 2}]`, "", "id,name\n18446744073709551615,a\n2,"},
+		{`{"state": "NORMAL", "nodes": 3}`, "", "key,value\nnodes,3\nstate,NORMAL"},
+		{`[1, null, "two"]`, "", "value\n1\n\ntwo"},
+		{`{"a": {"b": 1}}`, "", "key,value\na,\"{\"\"b\"\":1}\""},
+		{`"text"`, "", colorString(jsonStringColor, `"text"`)},
+	}
+	for _, test := range tests {
+		got := formatResponse(formatCSV, newDecodedResponse([]byte(test.body), test.query), nil)
+		if got != test.expected {
+			t.Errorf("%s: got %q, expected %q", test.body, got, test.expected)
+		}
+	}
+}
+
+func TestFormatResponseJSONKeepsPrecision(t *testing.T) {
+	body := `{"results":[{"attrs":{"big":9007199254740993,"f":1.5},"bits":[18446744073709551615]},[]],"e":{},"n":null,"s":"a\"b","t":true}`
+	expected := strings.Join([]string{
+		"{",
+		`  ` + colorString(jsonKeyColor, `"e"`) + `: {},`,
+		`  ` + colorString(jsonKeyColor, `"n"`) + `: ` + colorString(jsonNullColor, "null") + `,`,
+		`  ` + colorString(jsonKeyColor, `"results"`) + `: [`,
+		`    {`,
+		`      ` + colorString(jsonKeyColor, `"attrs"`) + `: {`,
+		`        ` + colorString(jsonKeyColor, `"big"`) + `: ` + colorString(jsonNumberColor, "9007199254740993") + `,`,
+		`        ` + colorString(jsonKeyColor, `"f"`) + `: ` + colorString(jsonNumberColor, "1.5"),
+		`      },`,
+		`      ` + colorString(jsonKeyColor, `"bits"`) + `: [`,
+		`        ` + colorString(jsonNumberColor, "18446744073709551615"),
+		`      ]`,
+		`    },`,
+		`    []`,
+		`  ],`,
+		`  ` + colorString(jsonKeyColor, `"s"`) + `: ` + colorString(jsonStringColor, `"a\"b"`) + `,`,
+		`  ` + colorString(jsonKeyColor, `"t"`) + `: ` + colorString(jsonBoolColor, "true"),
+		"}",
+	}, "\n")
+	if got := string(tryPrettifyJSON([]byte(body))); got != expected {
+		t.Fatalf("got\n%s\nexpected\n%s", got, expected)
+	}
+	// query responses are rendered from the decoded response
+	response := newDecodedResponse([]byte(`{"results":[{"attrs":{},"bits":[18446744073709551615]}]}`), "")
+	if got := formatResponse(formatJSON, response, nil); !strings.Contains(got, colorString(jsonNumberColor, "18446744073709551615")) {
+		t.Fatalf("got\n%s", got)
+	}
+}
+
+func TestFormatResponseYAML(t *testing.T) {
+	body := `{"results": [{"attrs": {"name": "yes", "n": 1.5}, "bits": [18446744073709551615]}, [], {}]}`
+	expected := strings.Join([]string{
+		"results:",
+		"  - attrs:",
+		"      n: 1.5",
+		`      name: "yes"`,
+		"    bits:",
+		"      - 18446744073709551615",
+		"  - []",
+		// the bitmap is decoded, so its missing keys are displayed
+		"  - attrs: {}",
+		"    bits: []",
+	}, "\n")
+	if got := formatResponse(formatYAML, newDecodedResponse([]byte(body), ""), nil); got != expected {
+		t.Fatalf("got\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	tests := map[string]string{
+		"plain":   "plain",
+		"":        `""`,
+		"true":    `"true"`,
+		"No":      `"No"`,
+		"12":      `"12"`,
+		"a: b":    `"a: b"`,
+		"-dash":   `"-dash"`,
+		" space":  `" space"`,
+		"two\nln": `"two\nln"`,
+	}
+	for s, expected := range tests {
+		if got := yamlString(s); got != expected {
+			t.Errorf("%q: got %s, expected %s", s, got, expected)
+		}
+	}
+}
+
+func TestFormatResponseTableForOtherValues(t *testing.T) {
+	got := formatResponse(formatTable, newDecodedResponse([]byte(`{"state": "NORMAL", "nodes": 3}`), ""), nil)
+	lines := strings.Split(got, "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "key") || !strings.HasPrefix(lines[2], "nodes  3") ||
+		!strings.HasPrefix(lines[3], "state  NORMAL") {
+		t.Fatalf("got\n%s", got)
+	}
+	if got := formatResponse(formatTable, newDecodedResponse([]byte(`12`), ""), nil); got != colorString(jsonNumberColor, "12") {
+		t.Fatalf("scalars should be displayed as JSON, got %s", got)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	if _, err := decodeJSON([]byte(`{} {}`)); err == nil {
+		t.Fatalf("expected an error for trailing data")
+	}
+	value, err := decodeJSON([]byte(`[18446744073709551615] `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatScalar(value.([]interface{})[0]) != "18446744073709551615" {
+		t.Fatalf("got %v", value)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	healthCheckTimeout = 2 * time.Second
+	// degradedLatency is the response time above which a server is considered degraded.
+	degradedLatency = time.Second
+)
+
+type connectionState int
+
+const (
+	stateOK connectionState = iota
+	stateDegraded
+	stateDown
+)
+
+func (s connectionState) String() string {
+	switch s {
+	case stateOK:
+		return "ok"
+	case stateDegraded:
+		return "degraded"
+	}
+	return "down"
+}
+
+func (s connectionState) color() Ansi {
+	switch s {
+	case stateOK:
+		return fgGreen
+	case stateDegraded:
+		return fgYellow
+	}
+	return fgRed
+}
+
+type healthMonitor struct {
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newProbeClient returns a client with a short timeout, to check whether the server at addr responds.
+// Clients for other nodes are derived from it with forHost, so all probes share its connection pool.
+func newProbeClient(addr string) (*Client, error) {
+	client, err := NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	client.httpClient.Timeout = healthCheckTimeout
+	return client, nil
+}
+
+// probe returns how long the server took to respond.
+func (c *Client) probe() (time.Duration, error) {
+	tic := time.Now()
+	_, err := c.serverVersion()
+	return time.Since(tic), err
+}
+
+func (conn *connection) getState() connectionState {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.state
+}
+
+// checkHealth probes the server and updates the state of the connection.
+// It returns true if the state changed.
+func (conn *connection) checkHealth() bool {
+	elapsed, err := conn.probe.probe()
+	state := stateOK
+	if err != nil {
+		state = stateDown
+	} else if elapsed > degradedLatency {
+		state = stateDegraded
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	changed := state != conn.state
+	conn.state = state
+	if state == stateDown {
+		conn.reconnect = true
+	}
+	return changed
+}
+
+// ensureConnected recreates the clients of a connection whose server was down, if it is back.
+func (c *Console) ensureConnected(conn *connection) {
+	conn.mu.Lock()
+	reconnect := conn.reconnect
+	conn.mu.Unlock()
+	if !reconnect {
+		return
+	}
+	c.checkConnection(conn)
+	if conn.getState() == stateDown {
+		return
+	}
+	err := conn.connect()
+	if err != nil {
+		printError(fmt.Errorf("Cannot reconnect to %s: %s", conn.address(), err))
+		return
+	}
+	conn.mu.Lock()
+	conn.reconnect = false
+	conn.mu.Unlock()
+	fmt.Println(colorString(fgGreen, fmt.Sprintf("Reconnected to %s", conn.address())))
+}
+
+func (c *Console) checkConnection(conn *connection) {
+	if conn.checkHealth() && conn == c.conn {
+		c.updatePrompt()
+	}
+}
+
+func (c *Console) executeHealthCommand(cmd string, args []string) error {
+	switch {
+	case len(args) == 0:
+		if len(c.connections) == 0 {
+			return errNotConnected
+		}
+		for _, name := range c.listConnectionNames()("") {
+			conn := c.connections[name]
+			c.checkConnection(conn)
+			state := conn.getState()
+			fmt.Fprintf(c.stdout, "%s\t%s\t%s\n", name, conn.address(), colorString(state.color(), state.String()))
+		}
+		return nil
+	case args[0] == "auto" && len(args) >= 2 && len(args) <= 3:
+		switch args[1] {
+		case "on":
+			interval, err := parseWatchInterval(args[2:])
+			if err != nil {
+				return err
+			}
+			c.startHealthMonitor(interval)
+			return nil
+		case "off":
+			if len(args) == 2 {
+				c.stopHealthMonitor()
+				return nil
+			}
+		}
+	}
+	return errors.New("usage: :health [auto {on [interval] | off}]")
+}
+
+// startHealthMonitor checks the health of all connections in the background.
+// Clients are not recreated in the background, that is done before the next command.
+// The monitor is restarted when the connections change.
+func (c *Console) startHealthMonitor(interval time.Duration) {
+	c.stopHealthMonitor()
+	monitor := &healthMonitor{
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	conns := make([]*connection, 0, len(c.connections))
+	for _, conn := range c.connections {
+		conns = append(conns, conn)
+	}
+	monitor.wg.Add(1)
+	go func() {
+		defer monitor.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-monitor.stop:
+				return
+			case <-ticker.C:
+			}
+			for _, conn := range conns {
+				if conn.checkHealth() {
+					c.refreshPrompt(conn)
+				}
+			}
+		}
+	}()
+	c.healthMonitor = monitor
+}
+
+func (c *Console) stopHealthMonitor() {
+	if c.healthMonitor == nil {
+		return
+	}
+	close(c.healthMonitor.stop)
+	c.healthMonitor.wg.Wait()
+	c.healthMonitor = nil
+}
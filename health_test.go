@@ -0,0 +1,107 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newVersionServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version": "v0.4.0"}`))
+	}))
+}
+
+func TestProbeNodes(t *testing.T) {
+	up := newVersionServer()
+	defer up.Close()
+	down := newVersionServer()
+	downHost := strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+	upHost := strings.TrimPrefix(up.URL, "http://")
+
+	probe, err := newProbeClient(upHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer probe.close()
+	nodes := []*nodeStatus{{Host: upHost}, {Host: downHost}}
+	reachable := probeNodes(probe, nodes)
+	if !reachable[upHost] {
+		t.Errorf("%s should be reachable", upHost)
+	}
+	if reachable[downHost] {
+		t.Errorf("%s should not be reachable", downHost)
+	}
+}
+
+func TestProbeClientIsShared(t *testing.T) {
+	probe, err := newProbeClient("localhost:10101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probe.httpClient.Timeout != healthCheckTimeout {
+		t.Fatalf("timeout: %s", probe.httpClient.Timeout)
+	}
+	node, err := probe.forHost("localhost:10102")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.httpClient != probe.httpClient {
+		t.Fatalf("node clients should share the HTTP client of the probe")
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	server := newVersionServer()
+	probe, err := newProbeClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &connection{probe: probe, state: stateDown}
+	if !conn.checkHealth() || conn.getState() != stateOK {
+		t.Fatalf("state should change to ok, got %s", conn.getState())
+	}
+	if conn.checkHealth() {
+		t.Fatalf("state should not change")
+	}
+	server.Close()
+	if !conn.checkHealth() || conn.getState() != stateDown || !conn.reconnect {
+		t.Fatalf("state should change to down, got %s", conn.getState())
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxSavedResponses is the number of responses which can be referred to as _number.
+const maxSavedResponses = 20
+
+// maxSavedBytes limits the memory taken by the saved responses, the oldest ones are dropped first.
+// The last response is always kept.
+const maxSavedBytes = 64 * 1024 * 1024
+
+type savedResponse struct {
+	number int
+	*decodedResponse
+}
+
+// saveResponse keeps a query or :http response and returns its number.
+func (c *Console) saveResponse(response *decodedResponse) int {
+	c.lastResponse = response
+	c.responseCount++
+	c.responses = append(c.responses, &savedResponse{
+		number:          c.responseCount,
+		decodedResponse: response,
+	})
+	drop := len(c.responses) - maxSavedResponses
+	if drop < 0 {
+		drop = 0
+	}
+	size := 0
+	for i := len(c.responses) - 1; i >= drop; i-- {
+		size += c.responses[i].size()
+		if size > maxSavedBytes && i < len(c.responses)-1 {
+			drop = i + 1
+			break
+		}
+	}
+	if drop > 0 {
+		c.responses = append([]*savedResponse{}, c.responses[drop:]...)
+	}
+	return c.responseCount
+}
+
+// findResponse returns the last response for _, or the response with the given number for _number.
+func (c *Console) findResponse(ref string) (*savedResponse, error) {
+	if !isResponseRef(ref) {
+		return nil, fmt.Errorf("Invalid response reference: %s", ref)
+	}
+	if ref == "_" {
+		if c.lastResponse == nil {
+			return nil, errors.New("No response yet")
+		}
+		return &savedResponse{
+			number:          c.responseCount,
+			decodedResponse: c.lastResponse,
+		}, nil
+	}
+	number, _ := strconv.Atoi(ref[1:])
+	for _, response := range c.responses {
+		if response.number == number {
+			return response, nil
+		}
+	}
+	return nil, fmt.Errorf("Response %s is not available, only the last %d responses are kept, up to %s",
+		ref, maxSavedResponses, formatByteSize(maxSavedBytes))
+}
+
+// executeShowResponse displays a saved response: _ or _number, optionally followed by full or a path filter.
+func (c *Console) executeShowResponse(line string) error {
+	if isFilterLine(line) {
+		if strings.HasPrefix(line, ".") {
+			return c.executeFilter("_", line)
+		}
+		ref := strings.Fields(line)[0]
+		return c.executeFilter(ref, strings.TrimSpace(line[len(ref):]))
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 2 || (len(fields) == 2 && fields[1] != "full") {
+		return errors.New("usage: _[number] [full | path]")
+	}
+	response, err := c.findResponse(fields[0])
+	if err != nil {
+		return err
+	}
+	if len(fields) == 2 {
+		return c.emitResponseLimit(response.decodedResponse, 0)
+	}
+	return c.emitResponse(response.decodedResponse)
+}
+
+func isResponseRef(s string) bool {
+	if !strings.HasPrefix(s, "_") {
+		return false
+	}
+	for _, r := range s[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isResponseLine(line string) bool {
+	return isResponseRef(strings.Fields(line)[0]) || strings.HasPrefix(line, ".")
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestSaveResponseKeepsTheLastResponses(t *testing.T) {
+	c := newTestConsole(ioutil.Discard)
+	for i := 0; i < maxSavedResponses+5; i++ {
+		c.saveResponse(newDecodedResponse([]byte(`{"results":[1]}`), "Count()"))
+	}
+	if len(c.responses) != maxSavedResponses || c.responses[0].number != 6 {
+		t.Fatalf("got %d responses starting at %d", len(c.responses), c.responses[0].number)
+	}
+	if _, err := c.findResponse("_5"); err == nil {
+		t.Fatal("_5 should not be available")
+	}
+	if response, err := c.findResponse("_6"); err != nil || response.number != 6 {
+		t.Fatalf("_6: %v, %v", response, err)
+	}
+}
+
+func TestSaveResponseLimitsTheSize(t *testing.T) {
+	c := newTestConsole(ioutil.Discard)
+	small := newDecodedResponse([]byte(`{"results":[1]}`), "Count()")
+	large := &decodedResponse{body: make([]byte, maxSavedBytes/2+1)}
+	tests := []struct {
+		response *decodedResponse
+		numbers  []int
+	}{
+		{small, []int{1}},
+		{large, []int{1, 2}},
+		{small, []int{1, 2, 3}},
+		// the first large response and the responses before it are dropped
+		{large, []int{3, 4}},
+		// the last response is kept even if it is larger than the limit
+		{&decodedResponse{body: make([]byte, maxSavedBytes+1)}, []int{5}},
+	}
+	for _, test := range tests {
+		c.saveResponse(test.response)
+		numbers := []int{}
+		for _, response := range c.responses {
+			numbers = append(numbers, response.number)
+		}
+		if !reflect.DeepEqual(numbers, test.numbers) {
+			t.Fatalf("got %v, want %v", numbers, test.numbers)
+		}
+	}
+	if response, err := c.findResponse("_"); err != nil || response.number != 5 {
+		t.Fatalf("_: %v, %v", response, err)
+	}
+}
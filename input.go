@@ -0,0 +1,121 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"io"
+	"sync"
+)
+
+// terminalInput reads the standard input in the background and hands it to one reader at a time.
+// Readline keeps a read pending until it is closed, so input typed after that is kept for the
+// next reader, the dashboard or the pager, instead of being lost.
+type terminalInput struct {
+	source  io.Reader
+	start   sync.Once
+	chunks  chan terminalChunk
+	mu      sync.Mutex
+	pending []byte
+	err     error
+}
+
+type terminalChunk struct {
+	data []byte
+	err  error
+}
+
+func newTerminalInput(source io.Reader) *terminalInput {
+	return &terminalInput{
+		source: source,
+		chunks: make(chan terminalChunk),
+	}
+}
+
+// reader returns a reader of the input. Closing it makes a pending read return io.EOF,
+// without consuming the input.
+func (t *terminalInput) reader() io.ReadCloser {
+	return &terminalReader{input: t, closed: make(chan struct{})}
+}
+
+func (t *terminalInput) readSource() {
+	for {
+		buf := make([]byte, 256)
+		n, err := t.source.Read(buf)
+		t.chunks <- terminalChunk{data: buf[:n], err: err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *terminalInput) read(p []byte, closed <-chan struct{}) (int, error) {
+	t.start.Do(func() { go t.readSource() })
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) == 0 && t.err == nil {
+		select {
+		case chunk := <-t.chunks:
+			t.pending, t.err = chunk.data, chunk.err
+		case <-closed:
+			return 0, io.EOF
+		}
+	}
+	if len(t.pending) > 0 {
+		n := copy(p, t.pending)
+		t.pending = t.pending[n:]
+		return n, nil
+	}
+	return 0, t.err
+}
+
+type terminalReader struct {
+	input     *terminalInput
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *terminalReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.closed:
+		return 0, io.EOF
+	default:
+	}
+	return r.input.read(p, r.closed)
+}
+
+func (r *terminalReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
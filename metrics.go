@@ -0,0 +1,167 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type metricsSample struct {
+	values map[string]interface{}
+	time   time.Time
+}
+
+func (c *Client) metrics() (*metricsSample, error) {
+	response, err := c.httpGet("/debug/vars")
+	if err != nil {
+		return nil, err
+	}
+	decoded := map[string]interface{}{}
+	err = json.Unmarshal(response.Body, &decoded)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	flattenJSON("", decoded, values)
+	return &metricsSample{
+		values: values,
+		time:   time.Now(),
+	}, nil
+}
+
+// flattenJSON joins the keys of nested objects with dots. Arrays are skipped.
+func flattenJSON(prefix string, value interface{}, out map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenJSON(key, item, out)
+		}
+	case []interface{}:
+		// skip
+	default:
+		out[prefix] = v
+	}
+}
+
+func (c *Console) executeMetricsCommand(cmd string, args []string) error {
+	if c.conn == nil {
+		return errNotConnected
+	}
+	if len(args) > 0 && args[0] == "watch" {
+		args = args[1:]
+		interval := defaultWatchInterval
+		if len(args) > 0 {
+			if d, err := parseWatchInterval(args[:1]); err == nil {
+				interval = d
+				args = args[1:]
+			}
+		}
+		if len(args) > 1 {
+			return errors.New("usage: :metrics [watch [interval]] [filter]")
+		}
+		filter := strings.Join(args, "")
+		var previous *metricsSample
+		return watch(interval, func() error {
+			sample, err := c.conn.httpClient.metrics()
+			if err != nil {
+				return err
+			}
+			printMetrics(os.Stdout, sample, previous, filter)
+			previous = sample
+			return nil
+		})
+	}
+	if len(args) > 1 {
+		return errors.New("usage: :metrics [watch [interval]] [filter]")
+	}
+	sample, err := c.conn.httpClient.metrics()
+	if err != nil {
+		return err
+	}
+	printMetrics(c.stdout, sample, nil, strings.Join(args, ""))
+	return nil
+}
+
+// printMetrics displays the metrics which contain filter in their names.
+// If a previous sample is given, the rate of change of numeric values is displayed as well.
+func printMetrics(w io.Writer, sample *metricsSample, previous *metricsSample, filter string) {
+	keys := make([]string, 0, len(sample.values))
+	for key := range sample.values {
+		if strings.Contains(key, filter) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := sample.values[key]
+		number, isNumber := value.(float64)
+		if !isNumber {
+			fmt.Fprintf(w, "%s = %v\n", key, value)
+			continue
+		}
+		line := fmt.Sprintf("%s = %s", key, formatNumber(number))
+		if previous != nil {
+			if previousNumber, ok := previous.values[key].(float64); ok {
+				elapsed := sample.time.Sub(previous.time).Seconds()
+				if elapsed > 0 {
+					rate := (number - previousNumber) / elapsed
+					rateText := fmt.Sprintf("%+.1f/s", rate)
+					if rate != 0 {
+						rateText = colorString(fgYellow, rateText)
+					}
+					line = fmt.Sprintf("%s (%s)", line, rateText)
+				}
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func formatNumber(number float64) string {
+	if number == float64(int64(number)) {
+		return fmt.Sprintf("%d", int64(number))
+	}
+	return fmt.Sprintf("%g", number)
+}
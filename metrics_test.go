@@ -0,0 +1,122 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlattenJSON(t *testing.T) {
+	value := map[string]interface{}{
+		"cmdline": []interface{}{"pilosa", "server"},
+		"memstats": map[string]interface{}{
+			"Alloc": 1024.0,
+			"GC":    map[string]interface{}{"Enabled": true},
+		},
+		"version": "v0.4.0",
+	}
+	values := map[string]interface{}{}
+	flattenJSON("", value, values)
+	want := map[string]interface{}{
+		"memstats.Alloc":      1024.0,
+		"memstats.GC.Enabled": true,
+		"version":             "v0.4.0",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("got %v, want %v", values, want)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := map[float64]string{0: "0", 42: "42", -7: "-7", 1.5: "1.5", 1e20: "1e+20"}
+	for number, want := range tests {
+		if got := formatNumber(number); got != want {
+			t.Errorf("formatNumber(%v) = %q, want %q", number, got, want)
+		}
+	}
+}
+
+func TestPrintMetrics(t *testing.T) {
+	now := time.Now()
+	previous := &metricsSample{
+		values: map[string]interface{}{"index.i.query": 10.0, "index.i.setBit": 4.0},
+		time:   now.Add(-2 * time.Second),
+	}
+	sample := &metricsSample{
+		values: map[string]interface{}{"index.i.query": 30.0, "index.i.setBit": 4.0, "index.i.name": "i", "memstats.Alloc": 1.0},
+		time:   now,
+	}
+	buf := &bytes.Buffer{}
+	printMetrics(buf, sample, previous, "index.")
+	want := "index.i.name = i\n" +
+		"index.i.query = 30 (" + colorString(fgYellow, "+10.0/s") + ")\n" +
+		"index.i.setBit = 4 (+0.0/s)\n"
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	buf.Reset()
+	printMetrics(buf, sample, nil, "memstats")
+	if buf.String() != "memstats.Alloc = 1\n" {
+		t.Fatalf("got %q", buf.String())
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debug/vars" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"index:i":{"query":3},"uptime":12}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample, err := client.metrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"index:i.query": 3.0, "uptime": 12.0}
+	if !reflect.DeepEqual(sample.values, want) {
+		t.Fatalf("got %v, want %v", sample.values, want)
+	}
+}
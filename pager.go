@@ -0,0 +1,215 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+type pagerMode int
+
+const (
+	pagerAuto pagerMode = iota
+	pagerOn
+	pagerOff
+)
+
+var pagerModes = map[string]pagerMode{
+	"auto": pagerAuto,
+	"on":   pagerOn,
+	"off":  pagerOff,
+}
+
+// defaultPager is used when $PAGER is not set. -R keeps the colors of the output.
+const defaultPager = "less -R"
+
+const pagerPrompt = "-- More -- (space: next page, enter: next line, q: quit)"
+
+func (m pagerMode) String() string {
+	for name, mode := range pagerModes {
+		if mode == m {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func (c *Console) executePagerCommand(cmd string, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(c.stdout, "Pager:", c.pager)
+		return nil
+	}
+	mode, ok := pagerModes[args[0]]
+	if len(args) != 1 || !ok {
+		return errors.New("usage: :pager [on | off | auto]")
+	}
+	c.pager = mode
+	return nil
+}
+
+// printOutput prints the output of a query or command. In auto mode, the output
+// goes through the pager only if it does not fit the terminal.
+func (c *Console) printOutput(text string) {
+	stdin, stdout := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if c.stdout != os.Stdout || c.pager == pagerOff || !readline.IsTerminal(stdin) || !readline.IsTerminal(stdout) {
+		fmt.Fprintln(c.stdout, text)
+		return
+	}
+	width, height, err := readline.GetSize(stdout)
+	if err != nil || height < 2 {
+		fmt.Fprintln(c.stdout, text)
+		return
+	}
+	lines := strings.Split(text, "\n")
+	if c.pager == pagerAuto && displayHeight(lines, width) < height {
+		fmt.Fprintln(c.stdout, text)
+		return
+	}
+	err = c.releaseTerminal(func() error {
+		started, err := runExternalPager(text)
+		if started {
+			return err
+		}
+		state, err := readline.MakeRaw(stdin)
+		if err != nil {
+			return err
+		}
+		defer readline.Restore(stdin, state)
+		keys := c.input.reader()
+		defer keys.Close()
+		return runBuiltinPager(os.Stdout, keys, lines, width, height)
+	})
+	if err != nil {
+		printError(err)
+	}
+}
+
+// runExternalPager pipes text to $PAGER. It returns false if the pager is not available.
+func runExternalPager(text string) (bool, error) {
+	command := os.Getenv("PAGER")
+	if command == "" {
+		command = defaultPager
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	path, err := exec.LookPath(fields[0])
+	if err != nil {
+		return false, nil
+	}
+	cmd := exec.Command(path, fields[1:]...)
+	cmd.Stdin = strings.NewReader(text + "\n")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return true, cmd.Run()
+}
+
+// runBuiltinPager displays lines a page at a time, reading keys from in, which is in raw mode.
+func runBuiltinPager(w io.Writer, in io.Reader, lines []string, width int, height int) error {
+	buf := make([]byte, 8)
+	rows := height - 1
+	for len(lines) > 0 {
+		used := 0
+		for len(lines) > 0 {
+			lineHeight := displayHeight(lines[:1], width)
+			if used > 0 && used+lineHeight > rows {
+				break
+			}
+			// the terminal is in raw mode, so lines must end with \r\n
+			fmt.Fprint(w, lines[0], "\r\n")
+			used += lineHeight
+			lines = lines[1:]
+		}
+		if len(lines) == 0 {
+			break
+		}
+		fmt.Fprint(w, colorString(attrReverse, pagerPrompt))
+		n, err := in.Read(buf)
+		fmt.Fprint(w, "\r\033[K")
+		if err != nil {
+			return err
+		}
+		switch string(buf[:n]) {
+		case "q", "Q", "\003", "\033":
+			return nil
+		case "\r", "\n", "j", "\033[B":
+			rows = 1
+		default:
+			rows = height - 1
+		}
+	}
+	return nil
+}
+
+// displayHeight returns the number of terminal rows lines take, including wrapped lines.
+func displayHeight(lines []string, width int) int {
+	rows := 0
+	for _, line := range lines {
+		length := visibleLength(line)
+		if width <= 0 || length <= width {
+			rows++
+			continue
+		}
+		rows += (length + width - 1) / width
+	}
+	return rows
+}
+
+// visibleLength returns the number of characters of text, skipping color codes.
+func visibleLength(text string) int {
+	length := 0
+	inEscape := false
+	for _, r := range text {
+		switch {
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+		case r == '\033':
+			inEscape = true
+		default:
+			length++
+		}
+	}
+	return length
+}
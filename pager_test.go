@@ -0,0 +1,93 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDisplayHeight(t *testing.T) {
+	tests := []struct {
+		lines  []string
+		width  int
+		height int
+	}{
+		{[]string{"abc", ""}, 10, 2},
+		{[]string{"abcdefghij"}, 10, 1},
+		{[]string{"abcdefghijk"}, 10, 2},
+		{[]string{colorString(fgRed, "abcdefghij")}, 10, 1},
+		{[]string{"abcdefghijk"}, 0, 1},
+	}
+	for _, test := range tests {
+		if height := displayHeight(test.lines, test.width); height != test.height {
+			t.Errorf("displayHeight(%q, %d) = %d, want %d", test.lines, test.width, height, test.height)
+		}
+	}
+}
+
+func TestBuiltinPager(t *testing.T) {
+	lines := []string{"1", "2", "3", "4", "5", "6", "7"}
+	prompt := colorString(attrReverse, pagerPrompt) + "\r\033[K"
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"page", "  ", "1\r\n2\r\n3\r\n" + prompt + "4\r\n5\r\n6\r\n" + prompt + "7\r\n"},
+		{"line", "\r ", "1\r\n2\r\n3\r\n" + prompt + "4\r\n" + prompt + "5\r\n6\r\n7\r\n"},
+		{"quit", "q", "1\r\n2\r\n3\r\n" + prompt},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		input := newTerminalInput(iotest.OneByteReader(strings.NewReader(test.keys)))
+		if err := runBuiltinPager(buf, input.reader(), lines, 10, 4); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, buf.String(), test.want)
+		}
+	}
+}
+
+func TestBuiltinPagerStopsAtEndOfInput(t *testing.T) {
+	input := newTerminalInput(strings.NewReader(""))
+	err := runBuiltinPager(&bytes.Buffer{}, input.reader(), []string{"1", "2", "3"}, 10, 2)
+	if err == nil {
+		t.Fatal("expected an error at the end of the input")
+	}
+}
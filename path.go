@@ -0,0 +1,548 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// pathFunctions can follow a path after |, e.g. .results[0].bits | len
+var pathFunctions = map[string]func(interface{}) (interface{}, error){
+	"len":   pathLen,
+	"keys":  pathKeys,
+	"first": pathFirst,
+	"last":  pathLast,
+	"sum":   pathSum,
+	"min":   pathMin,
+	"max":   pathMax,
+}
+
+type pathStep struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// pathFilter selects values from a JSON document, e.g. .results[0].bits or .results[*].count.
+// Steps after a [*] apply to each element and the result is a list.
+type pathFilter struct {
+	text      string
+	steps     []pathStep
+	functions []string
+}
+
+func parsePathFilter(text string) (*pathFilter, error) {
+	filter := &pathFilter{text: strings.TrimSpace(text)}
+	parts := strings.Split(filter.text, "|")
+	path := strings.TrimSpace(parts[0])
+	for _, part := range parts[1:] {
+		name := strings.TrimSpace(part)
+		if _, ok := pathFunctions[name]; !ok {
+			return nil, fmt.Errorf("Unknown function: %s. Try one of %s", name, strings.Join(pathFunctionNames(), ", "))
+		}
+		filter.functions = append(filter.functions, name)
+	}
+	if !strings.HasPrefix(path, ".") {
+		return nil, fmt.Errorf("Invalid path: %s. Paths start with .", path)
+	}
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			j := i + 1
+			for j < len(path) && isPathNameChar(path[j]) {
+				j++
+			}
+			if j > i+1 {
+				filter.steps = append(filter.steps, pathStep{field: path[i+1 : j]})
+			}
+			i = j
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid path: %s. Missing ]", path)
+			}
+			step, err := parsePathIndex(path[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid path: %s. %s", path, err)
+			}
+			filter.steps = append(filter.steps, step)
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("Invalid path: %s. Unexpected %q", path, path[i])
+		}
+	}
+	return filter, nil
+}
+
+func parsePathIndex(text string) (pathStep, error) {
+	text = strings.TrimSpace(text)
+	if text == "*" {
+		return pathStep{wildcard: true}, nil
+	}
+	if len(text) >= 2 && (text[0] == '"' || text[0] == '\'') && text[len(text)-1] == text[0] {
+		return pathStep{field: text[1 : len(text)-1]}, nil
+	}
+	index, err := strconv.Atoi(text)
+	if err != nil {
+		return pathStep{}, fmt.Errorf("Invalid index [%s]", text)
+	}
+	return pathStep{index: index, isIndex: true}, nil
+}
+
+func isPathNameChar(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func pathFunctionNames() []string {
+	names := make([]string, 0, len(pathFunctions))
+	for name := range pathFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apply evaluates the filter on a response. Numbers are kept as json.Number so IDs don't lose precision.
+// The results of a query response are replaced by their view, see resultView.
+func (f *pathFilter) apply(response *decodedResponse) (interface{}, error) {
+	var root interface{}
+	if response.decoded != nil {
+		value := response.decoded.value()
+		results := make([]interface{}, len(response.decoded.results))
+		for i, result := range response.decoded.results {
+			results[i] = resultView(result)
+		}
+		value["results"] = results
+		root = value
+	} else {
+		var err error
+		root, err = decodeJSON(response.body)
+		if err != nil {
+			return nil, fmt.Errorf("The response is not JSON: %s", err)
+		}
+	}
+	values := []interface{}{root}
+	projected := false
+	for _, step := range f.steps {
+		next := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			switch {
+			case step.wildcard:
+				switch v := value.(type) {
+				case []interface{}:
+					next = append(next, v...)
+				case map[string]interface{}:
+					for _, key := range sortedKeys(v) {
+						next = append(next, v[key])
+					}
+				case nil:
+				default:
+					return nil, fmt.Errorf("Cannot iterate over %s", jsonTypeName(value))
+				}
+			case step.isIndex:
+				list, ok := value.([]interface{})
+				if !ok && value != nil {
+					return nil, fmt.Errorf("Cannot index %s with [%d]", jsonTypeName(value), step.index)
+				}
+				index := step.index
+				if index < 0 {
+					index += len(list)
+				}
+				if index >= 0 && index < len(list) {
+					next = append(next, list[index])
+				} else {
+					next = append(next, nil)
+				}
+			default:
+				object, ok := value.(map[string]interface{})
+				if !ok && value != nil {
+					return nil, fmt.Errorf("Cannot get .%s of %s", step.field, jsonTypeName(value))
+				}
+				next = append(next, object[step.field])
+			}
+		}
+		values = next
+		projected = projected || step.wildcard
+	}
+	var result interface{} = values
+	if !projected {
+		result = values[0]
+	}
+	for _, name := range f.functions {
+		var err error
+		result, err = pathFunctions[name](result)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return result, nil
+}
+
+// resultView returns a result as an object with its type, so the same path works for the results
+// of all calls: count has the count of Count results and the cardinality of bitmaps, bits and attrs
+// are set for bitmaps, pairs for TopN results and changed for SetBit and ClearBit results.
+func resultView(result *queryResult) map[string]interface{} {
+	view := map[string]interface{}{"type": result.kind.String()}
+	if result.call != "" {
+		view["call"] = result.call
+	}
+	switch result.kind {
+	case resultBitmap:
+		for key, value := range result.value().(map[string]interface{}) {
+			view[key] = value
+		}
+		view["count"] = json.Number(strconv.Itoa(len(result.bitmap.Bits)))
+	case resultCount:
+		view["count"] = result.value()
+	case resultTopN:
+		view["pairs"] = result.value()
+	case resultChanged:
+		view["changed"] = result.changed
+	}
+	return view
+}
+
+func pathLen(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return json.Number(strconv.Itoa(len(v))), nil
+	case map[string]interface{}:
+		return json.Number(strconv.Itoa(len(v))), nil
+	case string:
+		return json.Number(strconv.Itoa(utf8.RuneCountInString(v))), nil
+	case nil:
+		return json.Number("0"), nil
+	}
+	return nil, fmt.Errorf("%s has no length", jsonTypeName(value))
+}
+
+func pathKeys(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := []interface{}{}
+		for _, key := range sortedKeys(v) {
+			keys = append(keys, key)
+		}
+		return keys, nil
+	case []interface{}:
+		keys := make([]interface{}, len(v))
+		for i := range v {
+			keys[i] = json.Number(strconv.Itoa(i))
+		}
+		return keys, nil
+	}
+	return nil, fmt.Errorf("%s has no keys", jsonTypeName(value))
+}
+
+func pathFirst(value interface{}) (interface{}, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not an array", jsonTypeName(value))
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+func pathLast(value interface{}) (interface{}, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not an array", jsonTypeName(value))
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[len(list)-1], nil
+}
+
+// pathSum adds integers exactly, and the other numbers with the precision of big.Float.
+func pathSum(value interface{}) (interface{}, error) {
+	numbers, err := pathNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+	if integers, ok := pathIntegers(value); ok {
+		sum := new(big.Int)
+		for _, n := range integers {
+			sum.Add(sum, n)
+		}
+		return json.Number(sum.String()), nil
+	}
+	sum := new(big.Float)
+	for _, n := range numbers {
+		sum.Add(sum, n)
+	}
+	return bigNumber(sum), nil
+}
+
+func pathMin(value interface{}) (interface{}, error) {
+	return pathExtreme(value, -1)
+}
+
+func pathMax(value interface{}) (interface{}, error) {
+	return pathExtreme(value, 1)
+}
+
+func pathExtreme(value interface{}, sign int) (interface{}, error) {
+	numbers, err := pathNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	extreme := numbers[0]
+	for _, n := range numbers[1:] {
+		if n.Cmp(extreme) == sign {
+			extreme = n
+		}
+	}
+	return bigNumber(extreme), nil
+}
+
+func pathNumbers(value interface{}) ([]*big.Float, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not an array", jsonTypeName(value))
+	}
+	numbers := make([]*big.Float, len(list))
+	for i, item := range list {
+		n, ok := toBigFloat(item)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a number", jsonTypeName(item))
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+// toBigFloat converts JSON numbers to big.Float, which keeps 64 bit integers exact.
+func toBigFloat(value interface{}) (*big.Float, bool) {
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		text = string(v)
+	case float64:
+		return big.NewFloat(v), true
+	default:
+		return nil, false
+	}
+	n, ok := new(big.Float).SetString(text)
+	return n, ok
+}
+
+// pathIntegers converts the items of a list to big.Int if they are all integers.
+func pathIntegers(value interface{}) ([]*big.Int, bool) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	integers := make([]*big.Int, len(list))
+	for i, item := range list {
+		number, ok := item.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		integers[i], ok = new(big.Int).SetString(string(number), 10)
+		if !ok {
+			return nil, false
+		}
+	}
+	return integers, true
+}
+
+func bigNumber(n *big.Float) json.Number {
+	return json.Number(n.Text('f', -1))
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isFilterLine returns true for lines which filter a response: .path or _[number] .path
+func isFilterLine(line string) bool {
+	if strings.HasPrefix(line, ".") {
+		return true
+	}
+	fields := strings.Fields(line)
+	return isResponseRef(fields[0]) && len(fields) > 1 && strings.HasPrefix(fields[1], ".")
+}
+
+// isPathFunction returns true if the command after a | is a path function rather than a shell command.
+func isPathFunction(command string) bool {
+	fields := strings.Fields(strings.SplitN(command, "|", 2)[0])
+	if len(fields) == 0 {
+		return false
+	}
+	_, ok := pathFunctions[fields[0]]
+	return ok
+}
+
+func (c *Console) executeFilter(ref string, text string) error {
+	response, err := c.findResponse(ref)
+	if err != nil {
+		return err
+	}
+	filter, err := parsePathFilter(text)
+	if err != nil {
+		return err
+	}
+	value, err := filter.apply(response.decodedResponse)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	// the filtered value is not a query response, even if it looks like one
+	return c.emitResponseLimit(&decodedResponse{body: data}, 0)
+}
+
+var assertOperators = map[string]func(int) bool{
+	"==": func(cmp int) bool { return cmp == 0 },
+	"!=": func(cmp int) bool { return cmp != 0 },
+	"<":  func(cmp int) bool { return cmp < 0 },
+	"<=": func(cmp int) bool { return cmp <= 0 },
+	">":  func(cmp int) bool { return cmp > 0 },
+	">=": func(cmp int) bool { return cmp >= 0 },
+}
+
+func (c *Console) executeAssertCommand(cmd string, args []string) error {
+	ref := "_"
+	if len(args) > 0 && isResponseRef(args[0]) {
+		ref = args[0]
+		args = args[1:]
+	}
+	if len(args) < 3 {
+		return errors.New("usage: :assert [_number] path operator value")
+	}
+	path := strings.Join(args[:len(args)-2], " ")
+	operator, expectedText := args[len(args)-2], args[len(args)-1]
+	compare, ok := assertOperators[operator]
+	if !ok {
+		return fmt.Errorf("Invalid operator: %s. Try one of ==, !=, <, <=, > or >=", operator)
+	}
+	response, err := c.findResponse(ref)
+	if err != nil {
+		return err
+	}
+	filter, err := parsePathFilter(path)
+	if err != nil {
+		return err
+	}
+	actual, err := filter.apply(response.decodedResponse)
+	if err != nil {
+		return err
+	}
+	expected := parseAssertValue(expectedText)
+	cmp, ok := compareValues(actual, expected)
+	if !ok && operator != "==" && operator != "!=" {
+		return fmt.Errorf("Cannot compare %s with %s", jsonTypeName(actual), jsonTypeName(expected))
+	}
+	if !ok {
+		// values which are not numbers can only be equal or not
+		cmp = 1
+		if reflect.DeepEqual(actual, expected) {
+			cmp = 0
+		}
+	}
+	if !compare(cmp) {
+		data, _ := json.Marshal(actual)
+		return fmt.Errorf("Assertion failed: %s %s %s, the value is %s", path, operator, expectedText, data)
+	}
+	fmt.Fprintln(c.stdout, colorString(fgGreen, "Assertion passed"))
+	return nil
+}
+
+// parseAssertValue parses a JSON value; anything else is taken as a string.
+func parseAssertValue(text string) interface{} {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return strings.Trim(text, `'"`)
+	}
+	return value
+}
+
+// compareValues compares numbers and strings. It returns false for other values.
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	if x, ok := toBigFloat(a); ok {
+		if y, ok := toBigFloat(b); ok {
+			return x.Cmp(y), true
+		}
+		return 0, false
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParsePathFilter(t *testing.T) {
+	tests := []struct {
+		text      string
+		steps     []pathStep
+		functions []string
+	}{
+		{".", nil, nil},
+		{".results[0].bits", []pathStep{{field: "results"}, {index: 0, isIndex: true}, {field: "bits"}}, nil},
+		{".results[*].count | max", []pathStep{{field: "results"}, {wildcard: true}, {field: "count"}}, []string{"max"}},
+		{`.["a b"][-1] | keys | len`, []pathStep{{field: "a b"}, {index: -1, isIndex: true}}, []string{"keys", "len"}},
+		{".columnAttrs[ 2 ]['x']", []pathStep{{field: "columnAttrs"}, {index: 2, isIndex: true}, {field: "x"}}, nil},
+	}
+	for _, test := range tests {
+		filter, err := parsePathFilter(test.text)
+		if err != nil {
+			t.Errorf("%s: %s", test.text, err)
+			continue
+		}
+		if !pathStepsEqual(filter.steps, test.steps) || strings.Join(filter.functions, ",") != strings.Join(test.functions, ",") {
+			t.Errorf("%s: got %+v %v", test.text, filter.steps, filter.functions)
+		}
+	}
+	for _, text := range []string{"results", ".results[0", ".results[x]", ".a | nope", ".a!b"} {
+		if _, err := parsePathFilter(text); err == nil {
+			t.Errorf("%s: expected an error", text)
+		}
+	}
+}
+
+func pathStepsEqual(a []pathStep, b []pathStep) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func applyPath(t *testing.T, body string, query string, path string) string {
+	filter, err := parsePathFilter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := filter.apply(newDecodedResponse([]byte(body), query))
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPathFilterQueryResponse(t *testing.T) {
+	counts := `{"results":[12,8]}`
+	mixed := `{"results":[{"attrs":{"name":"a"},"bits":[1,18446744073709551615]},[{"id":5,"count":10},{"id":7,"count":3}],12,true,null],` +
+		`"columnAttrs":[{"id":1,"attrs":{"x":2}}]}`
+	mixedQuery := "Bitmap(frame=f, rowID=1) TopN(frame=f) Count(Bitmap(frame=f, rowID=2)) SetBit(frame=f, rowID=1, columnID=2) SetRowAttrs(frame=f, rowID=1, x=1)"
+	tests := []struct {
+		body     string
+		query    string
+		path     string
+		expected string
+	}{
+		{counts, "Count(Bitmap(frame=f, rowID=1)) Count(Bitmap(frame=f, rowID=2))", ".results[*].count", "[12,8]"},
+		{counts, "", ".results[*].count | sum", "20"},
+		{mixed, mixedQuery, ".results[*].type", `["bitmap","topn","count","changed","none"]`},
+		{mixed, mixedQuery, ".results[*].count", "[2,null,12,null,null]"},
+		{mixed, mixedQuery, ".results[0].bits[-1]", "18446744073709551615"},
+		{mixed, mixedQuery, ".results[0].attrs.name", `"a"`},
+		{mixed, mixedQuery, ".results[1].pairs[*].id", "[5,7]"},
+		{mixed, mixedQuery, ".results[1].pairs[*].count | max", "10"},
+		{mixed, mixedQuery, ".results[1].call", `"TopN"`},
+		{mixed, mixedQuery, ".results[3].changed", "true"},
+		{mixed, mixedQuery, ".columnAttrs[0].attrs.x", "2"},
+		{mixed, mixedQuery, ".results[9]", "null"},
+		{`{"nodes":[{"host":"a"},{"host":"b"}]}`, "", ".nodes[*].host", `["a","b"]`},
+		{`{"nodes":[{"host":"a"}]}`, "", ".nodes.host", "error: Cannot get .host of array"},
+	}
+	for _, test := range tests {
+		if got := applyPath(t, test.body, test.query, test.path); got != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.path, got, test.expected)
+		}
+	}
+}
+
+func TestPathFunctions(t *testing.T) {
+	tests := []struct {
+		body     string
+		path     string
+		expected string
+	}{
+		{`[18446744073709551615, 18446744073709551615, 1]`, ". | sum", "36893488147419103231"},
+		{`[1.5, 2, -0.25]`, ". | sum", "3.25"},
+		{`[]`, ". | sum", "0"},
+		{`[3, 18446744073709551615, 2]`, ". | max", "18446744073709551615"},
+		{`[3, -1, 2]`, ". | min", "-1"},
+		{`[]`, ". | min", "null"},
+		{`{"b": 1, "a": 2}`, ". | keys", `["a","b"]`},
+		{`{"b": 1, "a": 2}`, ". | len", "2"},
+		{`"héllo"`, ". | len", "5"},
+		{`[4, 5, 6]`, ". | first", "4"},
+		{`[4, 5, 6]`, ". | last", "6"},
+		{`[1, "a"]`, ". | sum", "error: sum: string is not a number"},
+		{`{"a": 1}`, ". | first", "error: first: object is not an array"},
+	}
+	for _, test := range tests {
+		if got := applyPath(t, test.body, "", test.path); got != test.expected {
+			t.Errorf("%s %s: got %s, expected %s", test.body, test.path, got, test.expected)
+		}
+	}
+}
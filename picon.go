@@ -35,16 +35,14 @@ DAMAGE.
 package picon
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
-
-	pj "github.com/hokaccha/go-prettyjson"
 )
 
 type promptInfo struct {
-	address string
-	index   string
+	connection string
+	address    string
+	index      string
 }
 
 func printError(err error) {
@@ -63,15 +61,11 @@ func autoSessionName() string {
 	return time.Now().Format("2006-01-02_15-04-05")
 }
 
+// tryPrettifyJSON returns text as colored and indented JSON, or as is if it is not JSON.
 func tryPrettifyJSON(text []byte) []byte {
-	jsonResponse := make(map[string]interface{})
-	err := json.Unmarshal(text, &jsonResponse)
-	if err != nil {
-		return text
-	}
-	prettyText, err := pj.Marshal(jsonResponse)
+	value, err := decodeJSON(text)
 	if err != nil {
 		return text
 	}
-	return prettyText
+	return []byte(prettyJSON(value))
 }
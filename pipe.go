@@ -0,0 +1,177 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+)
+
+// splitPipe splits a line ending with | shell-command. | characters in quotes
+// or brackets are not pipes, neither are path functions in filters, e.g. _ .results[0].bits | len
+func splitPipe(line string) (string, string, error) {
+	filter := isFilterLine(line) || strings.HasPrefix(line, ":assert ")
+	offset := 0
+	for {
+		i := indexTopLevel(line[offset:], "|")
+		if i < 0 {
+			return line, "", nil
+		}
+		i += offset
+		if filter && isPathFunction(line[i+1:]) {
+			offset = i + 1
+			continue
+		}
+		command := strings.TrimSpace(line[i+1:])
+		line = strings.TrimSpace(line[:i])
+		if command == "" || line == "" {
+			return "", "", errors.New("usage: query-or-command | shell-command")
+		}
+		return line, command, nil
+	}
+}
+
+func (c *Console) executeShellCommand(command string) error {
+	if command == "" {
+		return errors.New("usage: :! shell-command")
+	}
+	return c.releaseTerminal(func() error {
+		cmd := shellCommand(command)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		defer ignoreInterrupts()()
+		return commandError(cmd.Run())
+	})
+}
+
+// executePiped runs a query or command and writes its output to the standard input of a shell command.
+// The output is written without colors and bitmaps are not truncated; the footer is not written.
+// Errors and warnings are displayed on the terminal.
+func (c *Console) executePiped(line string, command string) error {
+	return c.releaseTerminal(func() error {
+		cmd := shellCommand(command)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Start()
+		if err != nil {
+			return err
+		}
+		defer ignoreInterrupts()()
+		// if the command exits before reading all of the output, the rest is not written
+		err = c.executeWithOutput(line, &ansiStripper{writer: stdin})
+		stdin.Close()
+		waitErr := cmd.Wait()
+		if err != nil {
+			return err
+		}
+		return commandError(waitErr)
+	})
+}
+
+// executeWithOutput runs a line with its output written to w, see executePiped.
+func (c *Console) executeWithOutput(line string, w io.Writer) error {
+	stdout, bitLimit := c.stdout, c.bitLimit
+	c.stdout, c.bitLimit, c.piping = w, 0, true
+	defer func() {
+		c.stdout, c.bitLimit, c.piping = stdout, bitLimit, false
+	}()
+	return c.executeLine(line)
+}
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return exec.Command(shell, "-c", command)
+}
+
+// commandError ignores the exit status of a shell command, the command reports its own errors.
+func commandError(err error) error {
+	if _, ok := err.(*exec.ExitError); ok {
+		return nil
+	}
+	return err
+}
+
+// ignoreInterrupts keeps Ctrl+C from stopping the console while a shell command runs,
+// the command receives it. The returned function restores the default behavior.
+func ignoreInterrupts() func() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	return func() {
+		signal.Stop(interrupt)
+	}
+}
+
+// ansiStripper removes color codes from the text written to it.
+type ansiStripper struct {
+	writer   io.Writer
+	inEscape bool
+}
+
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch {
+		case s.inEscape:
+			if b == 'm' {
+				s.inEscape = false
+			}
+		case b == '\033':
+			s.inEscape = true
+		default:
+			out = append(out, b)
+		}
+	}
+	_, err := s.writer.Write(out)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
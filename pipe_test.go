@@ -0,0 +1,163 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestSplitPipe(t *testing.T) {
+	tests := []struct {
+		line    string
+		rest    string
+		command string
+	}{
+		{"Count(Bitmap(frame='f', rowID=1))", "Count(Bitmap(frame='f', rowID=1))", ""},
+		{"TopN(frame='f', n=100) | grep 42", "TopN(frame='f', n=100)", "grep 42"},
+		{"_ | jq .results[0] | head", "_", "jq .results[0] | head"},
+		{`SetRowAttrs(frame="f", rowID=1, note="a | b")`, `SetRowAttrs(frame="f", rowID=1, note="a | b")`, ""},
+		{"SetRowAttrs(frame='f', rowID=1, note='a | b') | wc -l", "SetRowAttrs(frame='f', rowID=1, note='a | b')", "wc -l"},
+		{"_ .results[0].bits | len", "_ .results[0].bits | len", ""},
+		{"_ .results[*].count | max | xargs echo", "_ .results[*].count | max", "xargs echo"},
+		{".results[0].bits | sort -n", ".results[0].bits", "sort -n"},
+		{":assert _ .results[0] | len == 3", ":assert _ .results[0] | len == 3", ""},
+		{":schema | grep f", ":schema", "grep f"},
+	}
+	for _, test := range tests {
+		rest, command, err := splitPipe(test.line)
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+			continue
+		}
+		if rest != test.rest || command != test.command {
+			t.Errorf("%s: got %q, %q", test.line, rest, command)
+		}
+	}
+	for _, line := range []string{"Count() |", "| grep x", "Count() |  "} {
+		if _, _, err := splitPipe(line); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestExecuteWithOutput(t *testing.T) {
+	c := &Console{stdout: os.Stdout, bitLimit: 10}
+	buf := &bytes.Buffer{}
+	err := c.executeWithOutput(":bit-limit", &ansiStripper{writer: buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bitmaps are not truncated while the output is piped
+	if buf.String() != "Bit limit: off\n" {
+		t.Fatalf("got %q", buf.String())
+	}
+	if c.stdout != os.Stdout || c.bitLimit != 10 || c.piping {
+		t.Fatalf("the output was not restored: %v, %d, %t", c.stdout, c.bitLimit, c.piping)
+	}
+	err = c.executeWithOutput(":bit-limit x", buf)
+	if err == nil || c.stdout != os.Stdout || c.bitLimit != 10 {
+		t.Fatalf("the output was not restored after an error: %v", err)
+	}
+}
+
+func TestExecuteWithOutputKeepsPrecision(t *testing.T) {
+	bodies := []string{
+		`{"results":[{"attrs":{},"bits":[18446744073709551615]}]}`,
+		`{"id":9007199254740993}`,
+	}
+	for _, body := range bodies {
+		c := newTestConsole(os.Stdout)
+		c.saveResponse(newDecodedResponse([]byte(body), ""))
+		buf := &bytes.Buffer{}
+		if err := c.executeWithOutput("_", &ansiStripper{writer: buf}); err != nil {
+			t.Fatal(err)
+		}
+		compact := &bytes.Buffer{}
+		if err := json.Compact(compact, buf.Bytes()); err != nil {
+			t.Fatalf("%s: the output is not JSON: %s", body, buf.String())
+		}
+		if compact.String() != body {
+			t.Errorf("got %s, want %s", compact.String(), body)
+		}
+	}
+}
+
+// panicWriter panics when it is written to.
+type panicWriter struct{}
+
+func (panicWriter) Write(p []byte) (int, error) {
+	panic("write")
+}
+
+func TestExecuteWithOutputRestoresOnPanic(t *testing.T) {
+	c := &Console{stdout: os.Stdout, bitLimit: 10}
+	panicked := false
+	func() {
+		defer func() {
+			panicked = recover() != nil
+		}()
+		c.executeWithOutput(":bit-limit", panicWriter{})
+	}()
+	if !panicked {
+		t.Fatalf("writing the output should panic")
+	}
+	if c.stdout != os.Stdout || c.bitLimit != 10 || c.piping {
+		t.Fatalf("the output was not restored")
+	}
+}
+
+func TestStatsWithoutStatistics(t *testing.T) {
+	c := &Console{stdout: os.Stdout}
+	buf := &bytes.Buffer{}
+	if err := c.executeWithOutput(":stats", buf); err != nil {
+		t.Fatal(err)
+	}
+	if c.stats == nil {
+		t.Fatal("the statistics should be created")
+	}
+}
+
+func TestANSIStripper(t *testing.T) {
+	buf := &bytes.Buffer{}
+	stripper := &ansiStripper{writer: buf}
+	stripper.Write([]byte(colorString(fgRed, "red") + " plain \033[1"))
+	stripper.Write([]byte("m bold\033[0m"))
+	if buf.String() != "red plain  bold" {
+		t.Fatalf("got %q", buf.String())
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import "strings"
+
+// topLevelCalls returns the names of the top level PQL calls in the query, in order.
+func topLevelCalls(query string) []string {
+	return callNames(query, false)
+}
+
+// allCalls returns the names of the PQL calls in the query, including the nested calls, in order.
+func allCalls(query string) []string {
+	return callNames(query, true)
+}
+
+// callNames returns the names of the PQL calls outside of quotes; nested calls are included if nested is true.
+func callNames(query string, nested bool) []string {
+	calls := []string{}
+	depth := 0
+	var quote rune
+	name := []rune{}
+	for _, r := range query {
+		inCall := depth == 0 || nested
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			continue
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			if inCall && len(name) > 0 {
+				calls = append(calls, string(name))
+			}
+			depth++
+		case r == ')':
+			depth--
+		case inCall && (r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' && len(name) > 0):
+			name = append(name, r)
+			continue
+		case inCall && strings.ContainsRune(" \t\r\n", r):
+			continue
+		}
+		name = name[:0]
+	}
+	return calls
+}
+
+// indexTopLevel returns the index of the first character of line which is one of chars
+// and is not in quotes or brackets, or -1 if there is none.
+func indexTopLevel(line string, chars string) int {
+	depth := 0
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		case depth == 0 && strings.ContainsRune(chars, r):
+			return i
+		}
+	}
+	return -1
+}
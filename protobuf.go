@@ -0,0 +1,511 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// Minimal protocol buffers encoding of the Pilosa query messages,
+// see internal/public.proto in the Pilosa repository.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+const (
+	attrTypeString = 1
+	attrTypeInt    = 2
+	attrTypeBool   = 3
+	attrTypeFloat  = 4
+)
+
+var errInvalidProtobuf = errors.New("Invalid protobuf message")
+
+type pbQueryRequest struct {
+	query       string
+	slices      []uint64
+	columnAttrs bool
+}
+
+type pbQueryResponse struct {
+	err            string
+	results        []*pbQueryResult
+	columnAttrSets []*pbColumnAttrSet
+}
+
+type pbQueryResult struct {
+	bitmap  *pbBitmap
+	n       uint64
+	pairs   []*pbPair
+	changed bool
+}
+
+type pbBitmap struct {
+	bits  []uint64
+	attrs map[string]interface{}
+}
+
+type pbPair struct {
+	key   uint64
+	count uint64
+}
+
+type pbColumnAttrSet struct {
+	id    uint64
+	attrs map[string]interface{}
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendTag(buf []byte, field int, wireType int) []byte {
+	return appendVarint(buf, uint64(field<<3|wireType))
+}
+
+func (r *pbQueryRequest) marshal() []byte {
+	buf := []byte{}
+	if r.query != "" {
+		buf = appendTag(buf, 1, wireBytes)
+		buf = appendVarint(buf, uint64(len(r.query)))
+		buf = append(buf, r.query...)
+	}
+	if len(r.slices) > 0 {
+		packed := []byte{}
+		for _, slice := range r.slices {
+			packed = appendVarint(packed, slice)
+		}
+		buf = appendTag(buf, 2, wireBytes)
+		buf = appendVarint(buf, uint64(len(packed)))
+		buf = append(buf, packed...)
+	}
+	if r.columnAttrs {
+		buf = appendTag(buf, 3, wireVarint)
+		buf = appendVarint(buf, 1)
+	}
+	return buf
+}
+
+type pbReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *pbReader) done() bool {
+	return r.pos >= len(r.buf)
+}
+
+func (r *pbReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errInvalidProtobuf
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *pbReader) tag() (field int, wireType int, err error) {
+	v, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+func (r *pbReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(r.buf)-r.pos) < n {
+		return nil, errInvalidProtobuf
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *pbReader) fixed64() (uint64, error) {
+	if len(r.buf)-r.pos < 8 {
+		return 0, errInvalidProtobuf
+	}
+	v := binary.LittleEndian.Uint64(r.buf[r.pos:])
+	r.pos += 8
+	return v, nil
+}
+
+func (r *pbReader) skip(wireType int) error {
+	var err error
+	switch wireType {
+	case wireVarint:
+		_, err = r.varint()
+	case wireFixed64:
+		_, err = r.fixed64()
+	case wireBytes:
+		_, err = r.bytes()
+	case wireFixed32:
+		if len(r.buf)-r.pos < 4 {
+			return errInvalidProtobuf
+		}
+		r.pos += 4
+	default:
+		err = errInvalidProtobuf
+	}
+	return err
+}
+
+// uint64s reads a repeated uint64 field, which may be packed or not.
+func (r *pbReader) uint64s(wireType int, values []uint64) ([]uint64, error) {
+	if wireType == wireVarint {
+		v, err := r.varint()
+		return append(values, v), err
+	}
+	b, err := r.bytes()
+	if err != nil {
+		return nil, err
+	}
+	packed := &pbReader{buf: b}
+	for !packed.done() {
+		v, err := packed.varint()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func unmarshalQueryResponse(buf []byte) (*pbQueryResponse, error) {
+	response := &pbQueryResponse{}
+	r := &pbReader{buf: buf}
+	for !r.done() {
+		field, wireType, err := r.tag()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			response.err = string(b)
+		case field == 2 && wireType == wireBytes:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			result, err := unmarshalQueryResult(b)
+			if err != nil {
+				return nil, err
+			}
+			response.results = append(response.results, result)
+		case field == 3 && wireType == wireBytes:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			set, err := unmarshalColumnAttrSet(b)
+			if err != nil {
+				return nil, err
+			}
+			response.columnAttrSets = append(response.columnAttrSets, set)
+		default:
+			err = r.skip(wireType)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return response, nil
+}
+
+func unmarshalQueryResult(buf []byte) (*pbQueryResult, error) {
+	result := &pbQueryResult{}
+	r := &pbReader{buf: buf}
+	for !r.done() {
+		field, wireType, err := r.tag()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			result.bitmap, err = unmarshalBitmap(b)
+			if err != nil {
+				return nil, err
+			}
+		case field == 2 && wireType == wireVarint:
+			result.n, err = r.varint()
+			if err != nil {
+				return nil, err
+			}
+		case field == 3 && wireType == wireBytes:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			pair, err := unmarshalPair(b)
+			if err != nil {
+				return nil, err
+			}
+			result.pairs = append(result.pairs, pair)
+		case field == 4 && wireType == wireVarint:
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			result.changed = v != 0
+		default:
+			err = r.skip(wireType)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func unmarshalBitmap(buf []byte) (*pbBitmap, error) {
+	bitmap := &pbBitmap{
+		bits:  []uint64{},
+		attrs: map[string]interface{}{},
+	}
+	r := &pbReader{buf: buf}
+	for !r.done() {
+		field, wireType, err := r.tag()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && (wireType == wireVarint || wireType == wireBytes):
+			bitmap.bits, err = r.uint64s(wireType, bitmap.bits)
+			if err != nil {
+				return nil, err
+			}
+		case field == 2 && wireType == wireBytes:
+			b, err := r.bytes()
+			if err != nil {
+				return nil, err
+			}
+			err = unmarshalAttr(b, bitmap.attrs)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			err = r.skip(wireType)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bitmap, nil
+}
+
+func unmarshalPair(buf []byte) (*pbPair, error) {
+	pair := &pbPair{}
+	r := &pbReader{buf: buf}
+	for !r.done() {
+		field, wireType, err := r.tag()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && wireType == wireVarint:
+			pair.key, err = r.varint()
+		case field == 2 && wireType == wireVarint:
+			pair.count, err = r.varint()
+		default:
+			err = r.skip(wireType)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pair, nil
+}
+
+func unmarshalColumnAttrSet(buf []byte) (*pbColumnAttrSet, error) {
+	set := &pbColumnAttrSet{attrs: map[string]interface{}{}}
+	r := &pbReader{buf: buf}
+	for !r.done() {
+		field, wireType, err := r.tag()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && wireType == wireVarint:
+			set.id, err = r.varint()
+		case field == 2 && wireType == wireBytes:
+			var b []byte
+			b, err = r.bytes()
+			if err == nil {
+				err = unmarshalAttr(b, set.attrs)
+			}
+		default:
+			err = r.skip(wireType)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// unmarshalAttr decodes an attribute and adds it to attrs.
+func unmarshalAttr(buf []byte, attrs map[string]interface{}) error {
+	var key string
+	var attrType uint64
+	var stringValue string
+	var intValue int64
+	var boolValue bool
+	var floatValue float64
+	r := &pbReader{buf: buf}
+	for !r.done() {
+		field, wireType, err := r.tag()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			var b []byte
+			b, err = r.bytes()
+			key = string(b)
+		case field == 2 && wireType == wireVarint:
+			attrType, err = r.varint()
+		case field == 3 && wireType == wireBytes:
+			var b []byte
+			b, err = r.bytes()
+			stringValue = string(b)
+		case field == 4 && wireType == wireVarint:
+			var v uint64
+			v, err = r.varint()
+			intValue = int64(v)
+		case field == 5 && wireType == wireVarint:
+			var v uint64
+			v, err = r.varint()
+			boolValue = v != 0
+		case field == 6 && wireType == wireFixed64:
+			var v uint64
+			v, err = r.fixed64()
+			floatValue = math.Float64frombits(v)
+		default:
+			err = r.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// numbers are kept as json.Number, like the attributes of JSON responses
+	switch attrType {
+	case attrTypeString:
+		attrs[key] = stringValue
+	case attrTypeInt:
+		attrs[key] = json.Number(strconv.FormatInt(intValue, 10))
+	case attrTypeBool:
+		attrs[key] = boolValue
+	case attrTypeFloat:
+		attrs[key] = json.Number(strconv.FormatFloat(floatValue, 'g', -1, 64))
+	}
+	return nil
+}
+
+// queryResponse converts the response to a decoded query response, see decodeQueryResponse.
+// Protobuf results do not include their types, so they are inferred from the PQL calls in the query.
+func (r *pbQueryResponse) queryResponse(calls []string) *queryResponse {
+	response := &queryResponse{results: make([]*queryResult, len(r.results))}
+	for i, result := range r.results {
+		call := ""
+		if i < len(calls) {
+			call = calls[i]
+		}
+		response.results[i] = result.queryResult(call)
+	}
+	for _, set := range r.columnAttrSets {
+		response.columnAttrs = append(response.columnAttrs, columnAttrSet{ID: set.id, Attrs: set.attrs})
+	}
+	return response
+}
+
+func (r *pbQueryResult) queryResult(call string) *queryResult {
+	result := &queryResult{call: call}
+	switch {
+	case r.bitmap != nil:
+		result.kind = resultBitmap
+		result.bitmap = &bitmapResult{Attrs: r.bitmap.attrs, Bits: r.bitmap.bits}
+		return result
+	case len(r.pairs) > 0 || call == "TopN":
+		result.kind = resultTopN
+		result.pairs = make([]pairResult, len(r.pairs))
+		for i, pair := range r.pairs {
+			result.pairs[i] = pairResult{ID: pair.key, Count: pair.count}
+		}
+		return result
+	}
+	switch call {
+	case "Count":
+		result.kind = resultCount
+		result.count = r.n
+	case "SetBit", "ClearBit", "Set", "Clear":
+		result.kind = resultChanged
+		result.changed = r.changed
+	case "SetRowAttrs", "SetColumnAttrs":
+		result.kind = resultNone
+	default:
+		if r.changed {
+			result.kind = resultChanged
+			result.changed = true
+		} else {
+			result.kind = resultCount
+			result.count = r.n
+		}
+	}
+	return result
+}
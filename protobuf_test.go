@@ -0,0 +1,313 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func appendBytesField(buf []byte, field int, b []byte) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = appendVarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	return appendVarint(appendTag(buf, field, wireVarint), v)
+}
+
+func TestMarshalQueryRequest(t *testing.T) {
+	request := &pbQueryRequest{query: "Count()", slices: []uint64{1, 300}, columnAttrs: true}
+	expected := []byte{0x0a, 7, 'C', 'o', 'u', 'n', 't', '(', ')', 0x12, 3, 1, 0xac, 0x02, 0x18, 1}
+	if got := request.marshal(); !bytes.Equal(got, expected) {
+		t.Fatalf("got % x, expected % x", got, expected)
+	}
+	if got := (&pbQueryRequest{}).marshal(); len(got) != 0 {
+		t.Fatalf("empty request should be empty, got % x", got)
+	}
+}
+
+func TestUnmarshalQueryResponse(t *testing.T) {
+	packed := appendVarint(appendVarint(nil, 3), 1000)
+	attr := appendBytesField(nil, 1, []byte("x"))
+	attr = appendVarintField(attr, 2, attrTypeInt)
+	attr = appendVarintField(attr, 4, 42)
+	floatAttr := appendBytesField(nil, 1, []byte("f"))
+	floatAttr = appendVarintField(floatAttr, 2, attrTypeFloat)
+	floatAttr = appendTag(floatAttr, 6, wireFixed64)
+	bits := math.Float64bits(1.5)
+	for i := 0; i < 8; i++ {
+		floatAttr = append(floatAttr, byte(bits>>(8*uint(i))))
+	}
+	bitmap := appendBytesField(nil, 1, packed)
+	bitmap = appendVarintField(bitmap, 1, 7) // unpacked bits are accepted as well
+	bitmap = appendBytesField(bitmap, 2, attr)
+	bitmap = appendBytesField(bitmap, 2, floatAttr)
+	pair := appendVarintField(appendVarintField(nil, 1, 5), 2, 10)
+
+	buf := appendBytesField(nil, 2, appendBytesField(nil, 1, bitmap))
+	buf = appendBytesField(buf, 2, appendVarintField(nil, 2, 12))
+	buf = appendBytesField(buf, 2, appendBytesField(nil, 3, pair))
+	buf = appendBytesField(buf, 2, appendVarintField(nil, 4, 1))
+	buf = appendVarintField(buf, 15, 99) // unknown fields are skipped
+
+	response, err := unmarshalQueryResponse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := response.queryResponse([]string{"Bitmap", "Count", "TopN", "SetBit"})
+	encoded, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"results":[{"attrs":{"f":1.5,"x":42},"bits":[3,1000,7]},12,[{"id":5,"count":10}],true]}`
+	if string(encoded) != expected {
+		t.Fatalf("got %s, expected %s", encoded, expected)
+	}
+}
+
+func TestUnmarshalQueryResponseError(t *testing.T) {
+	buf := appendBytesField(nil, 1, []byte("index not found"))
+	response, err := unmarshalQueryResponse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.err != "index not found" {
+		t.Fatalf("got %q", response.err)
+	}
+	for _, buf := range [][]byte{{0x0a, 5, 'a'}, {0x08}, {0x0f}} {
+		if _, err := unmarshalQueryResponse(buf); err != errInvalidProtobuf {
+			t.Errorf("% x: expected an error, got %v", buf, err)
+		}
+	}
+}
+
+func TestQueryProtobufDecodes(t *testing.T) {
+	body := appendBytesField(nil, 2, appendVarintField(nil, 2, 12))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", protobufContentType)
+		w.Write(body)
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.query("i", "Count(Bitmap(frame=f, rowID=1))", &queryOptions{transport: transportProtobuf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the body is kept as received, so the footer displays its size
+	if !bytes.Equal(response.Body, body) {
+		t.Fatalf("got body % x", response.Body)
+	}
+	decoded := response.decode("Count(Bitmap(frame=f, rowID=1))")
+	if decoded.body != nil || len(decoded.decoded.results) != 1 || decoded.decoded.results[0].count != 12 {
+		t.Fatalf("got %+v", decoded.decoded)
+	}
+	if string(decoded.jsonBody()) != `{"results":[12]}` {
+		t.Fatalf("got %s", decoded.jsonBody())
+	}
+}
+
+func TestQueryProtobufError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index/text/query" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", protobufContentType)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(appendBytesField(nil, 1, []byte("frame not found")))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := &queryOptions{transport: transportProtobuf}
+	_, err = client.query("pb", "Bitmap(frame=f, rowID=1)", options)
+	if err == nil || !strings.HasSuffix(err.Error(), ": frame not found") {
+		t.Fatalf("expected the decoded error, got %v", err)
+	}
+	_, err = client.query("text", "Bitmap(frame=f, rowID=1)", options)
+	if err == nil || !strings.Contains(err.Error(), "bad request") {
+		t.Fatalf("expected the text error, got %v", err)
+	}
+}
+
+func TestStreamQueryCompresses(t *testing.T) {
+	encodings := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		var body []byte
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			reader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body, _ = ioutil.ReadAll(reader)
+		} else {
+			body, _ = ioutil.ReadAll(r.Body)
+		}
+		if !strings.HasPrefix(string(body), "Count(") {
+			http.Error(w, "invalid query", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"results": [1]}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := "Count(Bitmap(frame=f, rowID=1))" + strings.Repeat(" ", gzipRequestThreshold)
+	stream := &streamOptions{maxSize: 1024}
+	results := []string{}
+	_, err = client.streamQuery("i", query, &queryOptions{gzip: true}, stream, func(call string, result json.RawMessage) {
+		results = append(results, string(result))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(encodings, []string{"gzip"}) || !reflect.DeepEqual(results, []string{"1"}) {
+		t.Fatalf("encodings %v, results %v", encodings, results)
+	}
+}
+
+func TestPostQueryFallsBackToUncompressed(t *testing.T) {
+	encodings := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		if r.Header.Get("Content-Encoding") != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Write([]byte(`{"results": [1]}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := "Count(Bitmap(frame=f, rowID=1))" + strings.Repeat(" ", gzipRequestThreshold)
+	options := &queryOptions{gzip: true}
+	for i := 0; i < 2; i++ {
+		if _, err := client.query("i", query, options); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(encodings, []string{"gzip", "", ""}) {
+		t.Fatalf("encodings %v", encodings)
+	}
+	if !client.compressionDisabled() {
+		t.Fatalf("compression should be disabled")
+	}
+}
+
+func TestPostQueryKeepsCompressionOnBadRequest(t *testing.T) {
+	encodings := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		http.Error(w, "invalid query", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := "Count(" + strings.Repeat(" ", gzipRequestThreshold)
+	_, err = client.query("i", query, &queryOptions{gzip: true})
+	if err == nil || !strings.Contains(err.Error(), "invalid query") {
+		t.Fatalf("expected the error of the server, got %v", err)
+	}
+	// the query is not sent again, since the server did understand the compressed query
+	if !reflect.DeepEqual(encodings, []string{"gzip"}) {
+		t.Fatalf("encodings %v", encodings)
+	}
+	if client.compressionDisabled() {
+		t.Fatalf("compression should not be disabled")
+	}
+}
+
+// benchmarkResponses returns the same response with a bitmap of n bits as JSON and as protobuf.
+func benchmarkResponses(n int) ([]byte, []byte) {
+	bits := make([]uint64, n)
+	packed := []byte{}
+	for i := range bits {
+		bits[i] = uint64(i) * 3
+		packed = appendVarint(packed, bits[i])
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"results": []interface{}{map[string]interface{}{"attrs": map[string]interface{}{}, "bits": bits}},
+	})
+	bitmap := appendBytesField(nil, 1, packed)
+	return body, appendBytesField(nil, 2, appendBytesField(nil, 1, bitmap))
+}
+
+func BenchmarkDecodeJSONResponse(b *testing.B) {
+	body, _ := benchmarkResponses(100000)
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeQueryResponse(body, "Bitmap(frame=f, rowID=1)"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeProtobufResponse(b *testing.B) {
+	_, body := benchmarkResponses(100000)
+	calls := topLevelCalls("Bitmap(frame=f, rowID=1)")
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		response, err := unmarshalQueryResponse(body)
+		if err != nil {
+			b.Fatal(err)
+		}
+		response.queryResponse(calls)
+	}
+}
@@ -0,0 +1,377 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type resultKind int
+
+const (
+	resultNone resultKind = iota
+	resultBitmap
+	resultCount
+	resultTopN
+	resultChanged
+)
+
+func (k resultKind) String() string {
+	switch k {
+	case resultBitmap:
+		return "bitmap"
+	case resultCount:
+		return "count"
+	case resultTopN:
+		return "topn"
+	case resultChanged:
+		return "changed"
+	}
+	return "none"
+}
+
+type bitmapResult struct {
+	Attrs map[string]interface{} `json:"attrs"`
+	Bits  []uint64               `json:"bits"`
+}
+
+type pairResult struct {
+	ID    uint64 `json:"id"`
+	Key   string `json:"key,omitempty"`
+	Count uint64 `json:"count"`
+}
+
+type columnAttrSet struct {
+	ID    uint64                 `json:"id"`
+	Attrs map[string]interface{} `json:"attrs"`
+}
+
+// queryResult is the result of a single PQL call.
+type queryResult struct {
+	call    string
+	kind    resultKind
+	bitmap  *bitmapResult
+	count   uint64
+	pairs   []pairResult
+	changed bool
+}
+
+type queryResponse struct {
+	results     []*queryResult
+	columnAttrs []columnAttrSet
+}
+
+// decodedResponse is a query or :http response. Query responses are decoded once, when they are received,
+// and the decoded response is used to display, filter and compare them.
+type decodedResponse struct {
+	query string
+	// body is the response as received, it is encoded from decoded on demand if it is nil, see jsonBody.
+	body []byte
+	// decoded is nil if the response is not a query response.
+	decoded *queryResponse
+}
+
+// newDecodedResponse decodes body if it is a query response.
+func newDecodedResponse(body []byte, query string) *decodedResponse {
+	response := &decodedResponse{query: query, body: body}
+	if decoded, err := decodeQueryResponse(body, query); err == nil {
+		response.decoded = decoded
+	}
+	return response
+}
+
+// jsonBody returns the response as JSON.
+func (r *decodedResponse) jsonBody() []byte {
+	if r.body == nil && r.decoded != nil {
+		r.body, _ = json.Marshal(r.decoded)
+	}
+	return r.body
+}
+
+// size estimates the memory taken by the response.
+func (r *decodedResponse) size() int {
+	size := len(r.body)
+	if r.decoded == nil {
+		return size
+	}
+	for _, result := range r.decoded.results {
+		// the attributes are not counted, they are small compared to the bits
+		size += 64
+		if result.bitmap != nil {
+			size += 8 * len(result.bitmap.Bits)
+		}
+		size += 32 * len(result.pairs)
+	}
+	return size + 64*len(r.decoded.columnAttrs)
+}
+
+// queryResponse returns the decoded response, or an error if it is not a query response.
+func (r *decodedResponse) queryResponse() (*queryResponse, error) {
+	if r.decoded == nil {
+		return nil, errors.New("Not a query response")
+	}
+	return r.decoded, nil
+}
+
+// decodeQueryResponse decodes a JSON query response. query is used to name the result of each call,
+// it may be empty.
+func decodeQueryResponse(body []byte, query string) (*queryResponse, error) {
+	response := struct {
+		// Results is nil if the key is missing, which is not the case for an empty array
+		Results     []json.RawMessage `json:"results"`
+		ColumnAttrs []columnAttrSet   `json:"columnAttrs"`
+		Error       string            `json:"error"`
+	}{}
+	err := unmarshalNumbers(body, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	if response.Results == nil {
+		return nil, errors.New("Not a query response")
+	}
+	calls := topLevelCalls(query)
+	decoded := &queryResponse{
+		results:     make([]*queryResult, len(response.Results)),
+		columnAttrs: response.ColumnAttrs,
+	}
+	for i, raw := range response.Results {
+		call := ""
+		if i < len(calls) {
+			call = calls[i]
+		}
+		decoded.results[i], err = decodeQueryResult(call, raw)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot decode result %d: %s", i, err)
+		}
+	}
+	return decoded, nil
+}
+
+func decodeQueryResult(call string, raw json.RawMessage) (*queryResult, error) {
+	result := &queryResult{call: call}
+	text := bytes.TrimSpace(raw)
+	if len(text) == 0 {
+		return nil, errors.New("empty result")
+	}
+	var err error
+	switch text[0] {
+	case '{':
+		result.kind = resultBitmap
+		result.bitmap = &bitmapResult{}
+		err = unmarshalNumbers(text, result.bitmap)
+		if result.bitmap.Bits == nil {
+			result.bitmap.Bits = []uint64{}
+		}
+		if result.bitmap.Attrs == nil {
+			result.bitmap.Attrs = map[string]interface{}{}
+		}
+	case '[':
+		result.kind = resultTopN
+		result.pairs = []pairResult{}
+		err = json.Unmarshal(text, &result.pairs)
+	case 't', 'f':
+		result.kind = resultChanged
+		err = json.Unmarshal(text, &result.changed)
+	case 'n':
+		result.kind = resultNone
+	default:
+		result.kind = resultCount
+		err = json.Unmarshal(text, &result.count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// unmarshalNumbers decodes JSON like json.Unmarshal, but keeps numbers in interface values,
+// e.g. attributes, as json.Number so they don't lose precision.
+func unmarshalNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// MarshalJSON encodes the response like the JSON query responses of the server.
+func (r *queryResponse) MarshalJSON() ([]byte, error) {
+	results := make([]interface{}, len(r.results))
+	for i, result := range r.results {
+		results[i] = result.jsonValue()
+	}
+	return json.Marshal(struct {
+		Results     []interface{}   `json:"results"`
+		ColumnAttrs []columnAttrSet `json:"columnAttrs,omitempty"`
+	}{results, r.columnAttrs})
+}
+
+// jsonValue returns the value which encodes the result like the server does.
+func (r *queryResult) jsonValue() interface{} {
+	switch r.kind {
+	case resultBitmap:
+		return r.bitmap
+	case resultCount:
+		return r.count
+	case resultTopN:
+		return r.pairs
+	case resultChanged:
+		return r.changed
+	}
+	return nil
+}
+
+// value returns the response as decodeJSON would decode its JSON encoding.
+func (r *queryResponse) value() map[string]interface{} {
+	results := make([]interface{}, len(r.results))
+	for i, result := range r.results {
+		results[i] = result.value()
+	}
+	value := map[string]interface{}{"results": results}
+	if len(r.columnAttrs) > 0 {
+		sets := make([]interface{}, len(r.columnAttrs))
+		for i, set := range r.columnAttrs {
+			sets[i] = map[string]interface{}{
+				"id":    json.Number(strconv.FormatUint(set.ID, 10)),
+				"attrs": set.Attrs,
+			}
+		}
+		value["columnAttrs"] = sets
+	}
+	return value
+}
+
+// value returns the result as decodeJSON would decode its JSON encoding.
+func (r *queryResult) value() interface{} {
+	switch r.kind {
+	case resultBitmap:
+		bits := make([]interface{}, len(r.bitmap.Bits))
+		for i, bit := range r.bitmap.Bits {
+			bits[i] = json.Number(strconv.FormatUint(bit, 10))
+		}
+		return map[string]interface{}{"attrs": r.bitmap.Attrs, "bits": bits}
+	case resultCount:
+		return json.Number(strconv.FormatUint(r.count, 10))
+	case resultTopN:
+		pairs := make([]interface{}, len(r.pairs))
+		for i, pair := range r.pairs {
+			value := map[string]interface{}{
+				"id":    json.Number(strconv.FormatUint(pair.ID, 10)),
+				"count": json.Number(strconv.FormatUint(pair.Count, 10)),
+			}
+			if pair.Key != "" {
+				value["key"] = pair.Key
+			}
+			pairs[i] = value
+		}
+		return pairs
+	case resultChanged:
+		return r.changed
+	}
+	return nil
+}
+
+// equal compares the values of the results, ignoring the call names and formatting.
+func (r *queryResult) equal(other *queryResult) bool {
+	if r.kind != other.kind {
+		return false
+	}
+	switch r.kind {
+	case resultBitmap:
+		return uint64sEqual(r.bitmap.Bits, other.bitmap.Bits) && attrsEqual(r.bitmap.Attrs, other.bitmap.Attrs)
+	case resultCount:
+		return r.count == other.count
+	case resultTopN:
+		if len(r.pairs) != len(other.pairs) {
+			return false
+		}
+		for i := range r.pairs {
+			if r.pairs[i] != other.pairs[i] {
+				return false
+			}
+		}
+		return true
+	case resultChanged:
+		return r.changed == other.changed
+	}
+	return true
+}
+
+func (r *queryResponse) equal(other *queryResponse) bool {
+	if len(r.results) != len(other.results) || len(r.columnAttrs) != len(other.columnAttrs) {
+		return false
+	}
+	for i := range r.results {
+		if !r.results[i].equal(other.results[i]) {
+			return false
+		}
+	}
+	for i := range r.columnAttrs {
+		if r.columnAttrs[i].ID != other.columnAttrs[i].ID || !attrsEqual(r.columnAttrs[i].Attrs, other.columnAttrs[i].Attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func uint64sEqual(a []uint64, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func attrsEqual(a map[string]interface{}, b map[string]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || fmt.Sprint(value) != fmt.Sprint(other) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// SliceWidth is the number of columns in a slice.
+const SliceWidth = 1 << 20
+
+type fragmentNode struct {
+	Host string
+}
+
+func (c *Client) maxSlices() (map[string]uint64, error) {
+	response, err := c.httpGet("/slices/max")
+	if err != nil {
+		return nil, err
+	}
+	slices := struct {
+		MaxSlices map[string]uint64 `json:"maxSlices"`
+	}{}
+	err = json.Unmarshal(response.Body, &slices)
+	if err != nil {
+		return nil, err
+	}
+	return slices.MaxSlices, nil
+}
+
+func (c *Client) fragmentNodes(index string, slice uint64) ([]*fragmentNode, error) {
+	query := url.Values{}
+	query.Set("index", index)
+	query.Set("slice", strconv.FormatUint(slice, 10))
+	response, err := c.httpGet("/fragment/nodes?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*fragmentNode{}
+	err = json.Unmarshal(response.Body, &nodes)
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+func (c *Console) executeSlicesCommand(cmd string, args []string) error {
+	if c.conn == nil {
+		return errNotConnected
+	}
+	if len(args) > 1 {
+		return errors.New("usage: :slices [index name | *]")
+	}
+	indexName := ""
+	if len(args) == 1 {
+		if args[0] != "*" {
+			indexName = args[0]
+		}
+	}
+	maxSlices, err := c.conn.httpClient.maxSlices()
+	if err != nil {
+		return err
+	}
+	if indexName != "" {
+		if _, ok := maxSlices[indexName]; !ok {
+			return fmt.Errorf("Index not found: %s", indexName)
+		}
+	}
+	names := make([]string, 0, len(maxSlices))
+	for name := range maxSlices {
+		if indexName == "" || name == indexName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		maxSlice := maxSlices[name]
+		fmt.Fprintf(c.stdout, "%s: max slice %d, columns 0-%d\n", name, maxSlice, (maxSlice+1)*SliceWidth-1)
+	}
+	return nil
+}
+
+func (c *Console) executeFragmentCommand(cmd string, args []string) error {
+	if c.conn == nil {
+		return errNotConnected
+	}
+	if len(args) != 2 {
+		return errors.New("usage: :fragment index-name slice")
+	}
+	slice, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid slice: %s", args[1])
+	}
+	nodes, err := c.conn.httpClient.fragmentNodes(args[0], slice)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "Slice %d of %s (columns %d-%d) is owned by:\n",
+		slice, args[0], slice*SliceWidth, (slice+1)*SliceWidth-1)
+	for _, node := range nodes {
+		fmt.Fprintf(c.stdout, "    %s\n", node.Host)
+	}
+	return nil
+}
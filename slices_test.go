@@ -0,0 +1,96 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSliceCommands(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slices/max":
+			w.Write([]byte(`{"maxSlices":{"users":2,"events":0}}`))
+		case "/fragment/nodes":
+			if r.URL.Query().Get("index") != "users" || r.URL.Query().Get("slice") != "1" {
+				http.Error(w, "fragment not found", http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`[{"host":"node1:10101"},{"host":"node2:10101"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	buf := &bytes.Buffer{}
+	c := newTestConsole(buf)
+	c.conn = newTestConnection(t, server.URL)
+	defer c.conn.close()
+
+	tests := []struct {
+		line   string
+		output string
+		err    string
+	}{
+		{":slices", "events: max slice 0, columns 0-1048575\nusers: max slice 2, columns 0-3145727\n", ""},
+		{":slices *", "events: max slice 0, columns 0-1048575\nusers: max slice 2, columns 0-3145727\n", ""},
+		{":slices users", "users: max slice 2, columns 0-3145727\n", ""},
+		{":slices other", "", "Index not found: other"},
+		{":slices a b", "", "usage: :slices"},
+		{":fragment users 1", "Slice 1 of users (columns 1048576-2097151) is owned by:\n    node1:10101\n    node2:10101\n", ""},
+		{":fragment users x", "", "Invalid slice: x"},
+		{":fragment users", "", "usage: :fragment"},
+		{":fragment events 1", "", "fragment not found"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		err := c.executeLine(test.line)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.line, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+		} else if buf.String() != test.output {
+			t.Errorf("%s: got %q, want %q", test.line, buf.String(), test.output)
+		}
+	}
+}
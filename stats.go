@@ -0,0 +1,160 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const recentQueryCount = 20
+
+type querySample struct {
+	query   string
+	elapsed time.Duration
+}
+
+type queryStats struct {
+	samples map[string][]time.Duration
+	queries []string
+	recent  []querySample
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{
+		samples: map[string][]time.Duration{},
+		queries: []string{},
+		recent:  []querySample{},
+	}
+}
+
+func (s *queryStats) add(query string, elapsed time.Duration) {
+	if _, ok := s.samples[query]; !ok {
+		s.queries = append(s.queries, query)
+	}
+	s.samples[query] = append(s.samples[query], elapsed)
+	s.recent = append(s.recent, querySample{query: query, elapsed: elapsed})
+	if len(s.recent) > recentQueryCount {
+		s.recent = s.recent[len(s.recent)-recentQueryCount:]
+	}
+}
+
+func (s *queryStats) reset() {
+	s.samples = map[string][]time.Duration{}
+	s.queries = []string{}
+	s.recent = []querySample{}
+}
+
+func (s *queryStats) print(w io.Writer) {
+	if len(s.queries) == 0 {
+		fmt.Fprintln(w, "No queries were run in this session")
+		return
+	}
+	fmt.Fprintf(w, "%6s %10s %10s %10s  %s\n", "count", "min", "avg", "p95", "query")
+	for _, query := range s.queries {
+		samples := s.samples[query]
+		min, avg, p95 := summarizeDurations(samples)
+		fmt.Fprintf(w, "%6d %10s %10s %10s  %s\n", len(samples),
+			formatDuration(min), formatDuration(avg), formatDuration(p95), query)
+	}
+}
+
+func summarizeDurations(samples []time.Duration) (min, avg, p95 time.Duration) {
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	total := time.Duration(0)
+	for _, d := range sorted {
+		total += d
+	}
+	p95Index := (len(sorted)*95+99)/100 - 1
+	return sorted[0], total / time.Duration(len(sorted)), sorted[p95Index]
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1f ms", float64(d)/float64(time.Millisecond))
+}
+
+func formatByteSize(size int) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// parseByteSize parses sizes like 512, 64KB or 10MB.
+func parseByteSize(text string) (int, error) {
+	multiplier := 1
+	number := strings.ToUpper(text)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSuffix(number, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(number))
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("Invalid size: %s", text)
+	}
+	return size * multiplier, nil
+}
+
+// queryFooter summarizes a query response, received is the response as it was received.
+func queryFooter(response *decodedResponse, received *HttpResponse, elapsed time.Duration) string {
+	count := 0
+	if response.decoded != nil {
+		count = len(response.decoded.results)
+	}
+	noun := "results"
+	if count == 1 {
+		noun = "result"
+	}
+	size := formatByteSize(len(received.Body))
+	if received.compressed {
+		size = fmt.Sprintf("%s (%s compressed)", size, formatByteSize(received.WireSize))
+	}
+	return fmt.Sprintf("%d %s, %s, %s", count, noun, size, formatDuration(elapsed))
+}
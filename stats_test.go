@@ -0,0 +1,136 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeDurations(t *testing.T) {
+	tests := []struct {
+		samples       []time.Duration
+		min, avg, p95 time.Duration
+	}{
+		{[]time.Duration{5}, 5, 5, 5},
+		{[]time.Duration{3, 1, 2}, 1, 2, 3},
+		{[]time.Duration{20, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, 1, 10, 19},
+	}
+	for _, test := range tests {
+		min, avg, p95 := summarizeDurations(test.samples)
+		if min != test.min || avg != test.avg || p95 != test.p95 {
+			t.Errorf("%v: got %d %d %d, want %d %d %d", test.samples, min, avg, p95, test.min, test.avg, test.p95)
+		}
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	stats := newQueryStats()
+	buf := &bytes.Buffer{}
+	stats.print(buf)
+	if buf.String() != "No queries were run in this session\n" {
+		t.Fatalf("got %q", buf.String())
+	}
+	stats.add("Count(Bitmap(frame=f, rowID=1))", 2*time.Millisecond)
+	stats.add("TopN(frame=f)", time.Millisecond)
+	stats.add("Count(Bitmap(frame=f, rowID=1))", 4*time.Millisecond)
+	buf.Reset()
+	stats.print(buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"     2     2.0 ms     3.0 ms     4.0 ms  Count(Bitmap(frame=f, rowID=1))",
+		"     1     1.0 ms     1.0 ms     1.0 ms  TopN(frame=f)",
+	}
+	if len(lines) != 3 || lines[1] != want[0] || lines[2] != want[1] {
+		t.Fatalf("got %q", buf.String())
+	}
+	for i := 0; i < recentQueryCount+5; i++ {
+		stats.add("Count(Bitmap(frame=f, rowID=1))", time.Millisecond)
+	}
+	if len(stats.recent) != recentQueryCount {
+		t.Fatalf("%d recent queries are kept", len(stats.recent))
+	}
+	stats.reset()
+	if len(stats.queries) != 0 || len(stats.recent) != 0 {
+		t.Fatalf("the statistics were not reset")
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		text string
+		size int
+		ok   bool
+	}{
+		{"512", 512, true},
+		{"512B", 512, true},
+		{"64KB", 64 << 10, true},
+		{"10mb", 10 << 20, true},
+		{"1GB", 1 << 30, true},
+		{"0", 0, false},
+		{"-1KB", 0, false},
+		{"ten", 0, false},
+	}
+	for _, test := range tests {
+		size, err := parseByteSize(test.text)
+		if (err == nil) != test.ok || size != test.size {
+			t.Errorf("parseByteSize(%q) = %d, %v", test.text, size, err)
+		}
+	}
+	for size, want := range map[int]string{100: "100 B", 1536: "1.5 KB", 3 << 20: "3.0 MB"} {
+		if got := formatByteSize(size); got != want {
+			t.Errorf("formatByteSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
+
+func TestQueryFooter(t *testing.T) {
+	tests := []struct {
+		response *HttpResponse
+		footer   string
+	}{
+		{&HttpResponse{Body: []byte(`{"results":[1]}`)}, "1 result, 15 B, 2.0 ms"},
+		{&HttpResponse{Body: []byte(`{"results":[1,2]}`), WireSize: 10, compressed: true}, "2 results, 17 B (10 B compressed), 2.0 ms"},
+		{&HttpResponse{Body: []byte(`{"results":[]}`)}, "0 results, 14 B, 2.0 ms"},
+	}
+	for _, test := range tests {
+		decoded := newDecodedResponse(test.response.Body, "")
+		if footer := queryFooter(decoded, test.response, 2*time.Millisecond); footer != test.footer {
+			t.Errorf("got %q, want %q", footer, test.footer)
+		}
+	}
+}
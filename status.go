@@ -0,0 +1,165 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type clusterStatus struct {
+	Nodes []*nodeStatus
+}
+
+type nodeStatus struct {
+	Host    string
+	State   string
+	Indexes []*indexStatus
+}
+
+type indexStatus struct {
+	Name     string
+	MaxSlice uint64
+	Slices   []uint64
+}
+
+func (c *Client) clusterStatus() (*clusterStatus, error) {
+	response, err := c.httpGet("/status")
+	if err != nil {
+		return nil, err
+	}
+	status := struct {
+		Status *clusterStatus
+	}{}
+	err = json.Unmarshal(response.Body, &status)
+	if err != nil {
+		return nil, err
+	}
+	if status.Status == nil {
+		return nil, fmt.Errorf("Invalid status response: %s", response.Body)
+	}
+	return status.Status, nil
+}
+
+func (c *Console) executeStatusCommand(cmd string, args []string) error {
+	if c.conn == nil {
+		return errNotConnected
+	}
+	switch {
+	case len(args) == 0:
+		return c.printClusterStatus()
+	case args[0] == "watch" && len(args) <= 2:
+		interval, err := parseWatchInterval(args[1:])
+		if err != nil {
+			return err
+		}
+		return watch(interval, c.printClusterStatus)
+	}
+	return errors.New("usage: :status [watch [interval]]")
+}
+
+func (c *Console) printClusterStatus() error {
+	status, err := c.conn.httpClient.clusterStatus()
+	if err != nil {
+		return err
+	}
+	reachable := probeNodes(c.conn.probe, status.Nodes)
+	for _, node := range status.Nodes {
+		state := node.State
+		color := fgGreen
+		if state != "UP" {
+			color = fgRed
+		}
+		if !reachable[node.Host] {
+			state = fmt.Sprintf("%s, unreachable", state)
+			color = fgRed
+		}
+		fmt.Fprintf(c.stdout, "%s %s\n", node.Host, colorString(color, state))
+		indexes := node.Indexes
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+		for _, index := range indexes {
+			fmt.Fprintf(c.stdout, "    %s: max slice %d, slices [%s]\n",
+				index.Name, index.MaxSlice, formatSlices(index.Slices))
+		}
+	}
+	return nil
+}
+
+// probeNodes checks whether each node responds, concurrently, with clients derived from probe.
+func probeNodes(probe *Client, nodes []*nodeStatus) map[string]bool {
+	reachable := map[string]bool{}
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			client, err := probe.forHost(host)
+			if err == nil {
+				_, err = client.probe()
+			}
+			mu.Lock()
+			reachable[host] = err == nil
+			mu.Unlock()
+		}(node.Host)
+	}
+	wg.Wait()
+	return reachable
+}
+
+// formatSlices collapses consecutive slices into ranges, e.g. 0-3, 7
+func formatSlices(slices []uint64) string {
+	sorted := make([]uint64, len(slices))
+	copy(sorted, slices)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	parts := []string{}
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, fmt.Sprintf("%d", sorted[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
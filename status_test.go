@@ -0,0 +1,122 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatSlices(t *testing.T) {
+	tests := []struct {
+		slices []uint64
+		text   string
+	}{
+		{[]uint64{}, ""},
+		{[]uint64{4}, "4"},
+		{[]uint64{3, 0, 1, 2, 7}, "0-3, 7"},
+		{[]uint64{1, 3, 5, 6}, "1, 3, 5-6"},
+	}
+	for _, test := range tests {
+		if text := formatSlices(test.slices); text != test.text {
+			t.Errorf("formatSlices(%v) = %q, want %q", test.slices, text, test.text)
+		}
+	}
+}
+
+func TestParseWatchInterval(t *testing.T) {
+	tests := []struct {
+		args     []string
+		interval time.Duration
+		ok       bool
+	}{
+		{nil, defaultWatchInterval, true},
+		{[]string{"500ms"}, 500 * time.Millisecond, true},
+		{[]string{"0s"}, 0, false},
+		{[]string{"-1s"}, 0, false},
+		{[]string{"often"}, 0, false},
+	}
+	for _, test := range tests {
+		interval, err := parseWatchInterval(test.args)
+		if (err == nil) != test.ok || interval != test.interval {
+			t.Errorf("parseWatchInterval(%v) = %s, %v", test.args, interval, err)
+		}
+	}
+}
+
+func TestPrintClusterStatus(t *testing.T) {
+	down := newVersionServer()
+	downHost := strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+	var upHost string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			w.Write([]byte(`{"version":"v0.4.0"}`))
+		case "/status":
+			fmt.Fprintf(w, `{"status":{"Nodes":[
+				{"Host":%q,"State":"UP","Indexes":[{"Name":"j","MaxSlice":0,"Slices":[0]},{"Name":"i","MaxSlice":3,"Slices":[3,0,1]}]},
+				{"Host":%q,"State":"UP","Indexes":[]}]}}`, upHost, downHost)
+		}
+	}))
+	defer server.Close()
+	upHost = strings.TrimPrefix(server.URL, "http://")
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe, err := newProbeClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	c := newTestConsole(buf)
+	c.conn = &connection{httpClient: client, probe: probe}
+	if err := c.printClusterStatus(); err != nil {
+		t.Fatal(err)
+	}
+	want := upHost + " " + colorString(fgGreen, "UP") + "\n" +
+		"    i: max slice 3, slices [0-1, 3]\n" +
+		"    j: max slice 0, slices [0]\n" +
+		downHost + " " + colorString(fgRed, "UP, unreachable") + "\n"
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,377 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+const defaultMaxResponseSize = 64 << 20
+
+var errResultTooLarge = errors.New("A result is larger than the response limit")
+
+// spillWriter keeps the response in memory up to maxSize bytes.
+// If the response gets larger, it is written to a file in the spill directory instead.
+type spillWriter struct {
+	maxSize   int
+	directory string
+	buf       bytes.Buffer
+	file      *os.File
+	closed    bool
+	size      int
+}
+
+func (w *spillWriter) Write(p []byte) (int, error) {
+	w.size += len(p)
+	if w.file != nil {
+		return w.file.Write(p)
+	}
+	if w.buf.Len()+len(p) <= w.maxSize {
+		return w.buf.Write(p)
+	}
+	if w.directory == "" {
+		return 0, fmt.Errorf("The response is larger than %s and no spill directory is set", formatByteSize(w.maxSize))
+	}
+	err := os.MkdirAll(w.directory, 0700)
+	if err != nil {
+		return 0, err
+	}
+	name := path.Join(w.directory, fmt.Sprintf("response-%s.json", time.Now().Format("2006-01-02_15-04-05.000")))
+	w.file, err = os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.file.Write(w.buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	// release the memory, Reset would keep it
+	w.buf = bytes.Buffer{}
+	n, err := w.file.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// spillReader copies what is read to the spill writer. Reading stops if a single result
+// gets larger than the maximum size, since the decoder keeps the whole result in memory.
+type spillReader struct {
+	reader io.Reader
+	writer *spillWriter
+	// resultSize is the size read since the last result was decoded.
+	resultSize int
+	// writeErr is kept since the decoder does not report it if the rest of the response was already read.
+	writeErr error
+}
+
+func (r *spillReader) Read(p []byte) (int, error) {
+	if r.resultSize > r.writer.maxSize {
+		return 0, errResultTooLarge
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.resultSize += n
+		_, r.writeErr = r.writer.Write(p[:n])
+		if r.writeErr != nil {
+			return n, r.writeErr
+		}
+	}
+	return n, err
+}
+
+func (w *spillWriter) close() error {
+	if w.file == nil || w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.file.Close()
+}
+
+type streamOptions struct {
+	maxSize        int
+	spillDirectory string
+	// output receives the response instead of memory and the spill directory, if it is set.
+	output *os.File
+}
+
+type streamResponse struct {
+	// body is the complete response if it was neither spilled nor written to the output
+	body      []byte
+	spillPath string
+	size      int
+	results   int
+	// incomplete is set if a result was too large to decode, the results after it were not decoded either.
+	incomplete bool
+}
+
+// streamQuery runs a PQL query using the JSON transport and calls onResult for each result as it is decoded.
+func (c *Client) streamQuery(index string, text string, options *queryOptions, stream *streamOptions,
+	onResult func(call string, result json.RawMessage)) (*streamResponse, error) {
+
+	params := url.Values{}
+	if options.columnAttrs {
+		params.Set("columnAttrs", "true")
+	}
+	if len(options.slices) > 0 {
+		params.Set("slices", joinSlices(options.slices))
+	}
+	path := "/index/" + index + "/query"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	response, err := c.sendQuery(path, []byte(text), http.Header{}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var body io.Reader = response.Body
+	if response.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		body = reader
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		buf, _ := ioutil.ReadAll(io.LimitReader(body, int64(stream.maxSize)))
+		return nil, fmt.Errorf("%s: %s", response.Status, buf)
+	}
+
+	writer := &spillWriter{
+		maxSize:   stream.maxSize,
+		directory: stream.spillDirectory,
+		file:      stream.output,
+	}
+	defer writer.close()
+	reader := &spillReader{reader: body, writer: writer}
+	calls := topLevelCalls(text)
+	results, err := decodeResults(json.NewDecoder(reader), func(i int, result json.RawMessage) {
+		reader.resultSize = 0
+		call := ""
+		if i < len(calls) {
+			call = calls[i]
+		}
+		onResult(call, result)
+	})
+	if reader.writeErr != nil {
+		return nil, reader.writeErr
+	}
+	incomplete := false
+	if err == errResultTooLarge && writer.file != nil {
+		// the rest of the response is only copied to the file
+		_, err = io.Copy(writer, body)
+		incomplete = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	streamed := &streamResponse{
+		size:       writer.size,
+		results:    results,
+		incomplete: incomplete,
+	}
+	if writer.file == nil {
+		streamed.body = writer.buf.Bytes()
+		return streamed, nil
+	}
+	streamed.spillPath = writer.file.Name()
+	return streamed, writer.close()
+}
+
+// decodeResults decodes the results array of a query response one result at a time.
+func decodeResults(decoder *json.Decoder, onResult func(i int, result json.RawMessage)) (int, error) {
+	count := 0
+	token, err := decoder.Token()
+	if err != nil {
+		return count, err
+	}
+	if token != json.Delim('{') {
+		return count, errors.New("Invalid query response")
+	}
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return count, err
+		}
+		if token != "results" {
+			var skipped json.RawMessage
+			err = decoder.Decode(&skipped)
+			if err != nil {
+				return count, err
+			}
+			continue
+		}
+		token, err = decoder.Token()
+		if err != nil {
+			return count, err
+		}
+		if token != json.Delim('[') {
+			return count, errors.New("Invalid query response")
+		}
+		for decoder.More() {
+			var result json.RawMessage
+			err = decoder.Decode(&result)
+			if err != nil {
+				return count, err
+			}
+			onResult(count, result)
+			count++
+		}
+		_, err = decoder.Token()
+		if err != nil {
+			return count, err
+		}
+	}
+	_, err = decoder.Token()
+	return count, err
+}
+
+func (c *Console) executeStreamingQuery(line string) error {
+	stream := &streamOptions{
+		maxSize:        c.maxResponseSize,
+		spillDirectory: c.spillDirectory,
+	}
+	if c.redirect != nil {
+		file, err := c.redirect.open()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		stream.output = file
+	}
+	tic := time.Now()
+	response, err := c.conn.httpClient.streamQuery(c.index.Name(), line, c.queryOptions, stream,
+		func(call string, raw json.RawMessage) {
+			if c.redirect != nil {
+				return
+			}
+			if c.format == formatRaw {
+				c.printOutput(string(raw))
+				return
+			}
+			// render each result as a single result response
+			result, err := decodeQueryResult(call, raw)
+			if err != nil {
+				c.printOutput(string(raw))
+				return
+			}
+			c.printOutput(c.renderResponse(&decodedResponse{
+				query:   call,
+				decoded: &queryResponse{results: []*queryResult{result}},
+			}))
+		})
+	elapsed := time.Since(tic)
+	if err != nil {
+		return err
+	}
+	c.stats.add(line, elapsed)
+	if c.redirect != nil {
+		c.lastResponse = nil
+		fmt.Println(colorString(attrDim, fmt.Sprintf("Wrote %s to %s", formatByteSize(response.size), c.redirect.path)))
+		return nil
+	}
+	prefix := ""
+	if response.spillPath != "" {
+		c.lastResponse = nil
+		printWarning(fmt.Sprintf("The response is larger than %s, it was written to %s",
+			formatByteSize(c.maxResponseSize), response.spillPath))
+		if response.incomplete {
+			printWarning(fmt.Sprintf("Only the first %d results were displayed, the next one is larger than %s",
+				response.results, formatByteSize(c.maxResponseSize)))
+		}
+	} else {
+		prefix = fmt.Sprintf("_%d: ", c.saveResponse(newDecodedResponse(response.body, line)))
+	}
+	if c.showFooter && !c.piping {
+		noun := "results"
+		if response.results == 1 {
+			noun = "result"
+		}
+		fmt.Println(colorString(attrDim, fmt.Sprintf("%s%d %s, %s, %s", prefix, response.results, noun,
+			formatByteSize(response.size), formatDuration(elapsed))))
+	}
+	return nil
+}
+
+func (c *Console) executeStreamCommand(cmd string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: :stream {on | off}")
+	}
+	switch args[0] {
+	case "on":
+		c.streaming = true
+	case "off":
+		c.streaming = false
+	default:
+		return fmt.Errorf("Invalid stream mode: %s", args[0])
+	}
+	return nil
+}
+
+func (c *Console) executeResponseLimitCommand(cmd string, args []string) error {
+	switch len(args) {
+	case 0:
+		spill := c.spillDirectory
+		if spill == "" {
+			spill = "(not set)"
+		}
+		fmt.Fprintf(c.stdout, "Maximum response size: %s, spill directory: %s\n", formatByteSize(c.maxResponseSize), spill)
+		return nil
+	case 1, 2:
+		size, err := parseByteSize(args[0])
+		if err != nil {
+			return err
+		}
+		c.maxResponseSize = size
+		if len(args) == 2 {
+			c.spillDirectory = args[1]
+		}
+		return nil
+	}
+	return errors.New("usage: :response-limit [size [spill-directory]]")
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func streamTestQuery(t *testing.T, body string, stream *streamOptions) (*streamResponse, []string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []string{}
+	response, err := client.streamQuery("i", "Count(Bitmap(frame=f, rowID=1))", &queryOptions{}, stream,
+		func(call string, result json.RawMessage) {
+			results = append(results, string(result))
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, results
+}
+
+func TestStreamQueryInMemory(t *testing.T) {
+	body := `{"results": [1, 2, 3]}`
+	response, results := streamTestQuery(t, body, &streamOptions{maxSize: 1024})
+	if !reflect.DeepEqual(results, []string{"1", "2", "3"}) {
+		t.Fatalf("results: %v", results)
+	}
+	if string(response.body) != body || response.spillPath != "" || response.results != 3 || response.incomplete {
+		t.Fatalf("response: %+v", response)
+	}
+}
+
+func TestStreamQuerySpillsAllResults(t *testing.T) {
+	directory, err := ioutil.TempDir("", "picon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	items := []string{}
+	for i := 0; i < 100; i++ {
+		items = append(items, `{"attrs":{},"bits":[1,2,3]}`)
+	}
+	body := `{"results": [` + strings.Join(items, ",") + `]}`
+	response, results := streamTestQuery(t, body, &streamOptions{maxSize: 100, spillDirectory: directory})
+	if len(results) != 100 || response.results != 100 || response.incomplete {
+		t.Fatalf("all results should be decoded after the spill, got %d: %+v", len(results), response)
+	}
+	if response.body != nil || path.Dir(response.spillPath) != directory {
+		t.Fatalf("response: %+v", response)
+	}
+	spilled, err := ioutil.ReadFile(response.spillPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(spilled) != body {
+		t.Fatalf("spilled: %s", spilled)
+	}
+}
+
+func TestStreamQueryLargeResult(t *testing.T) {
+	directory, err := ioutil.TempDir("", "picon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	bits := make([]string, 10000)
+	for i := range bits {
+		bits[i] = "1000000"
+	}
+	body := `{"results": [1, {"attrs":{},"bits":[` + strings.Join(bits, ",") + `]}, 2]}`
+	response, results := streamTestQuery(t, body, &streamOptions{maxSize: 1024, spillDirectory: directory})
+	if !reflect.DeepEqual(results, []string{"1"}) || !response.incomplete || response.results != 1 {
+		t.Fatalf("results %v, response %+v", results, response)
+	}
+	spilled, err := ioutil.ReadFile(response.spillPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(spilled) != body {
+		t.Fatalf("the spill file should have the whole response, got %d bytes", len(spilled))
+	}
+}
+
+func TestStreamQueryOutput(t *testing.T) {
+	file, err := ioutil.TempFile("", "picon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	body := `{"results": [1, 2]}`
+	response, results := streamTestQuery(t, body, &streamOptions{maxSize: 1024, output: file})
+	if len(results) != 2 || response.body != nil || response.spillPath != file.Name() {
+		t.Fatalf("results %v, response %+v", results, response)
+	}
+	written, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != body {
+		t.Fatalf("written: %s", written)
+	}
+}
+
+func TestStreamQueryLimitWithoutSpillDirectory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [` + strings.Repeat("1,", 1000) + `1]}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.streamQuery("i", "Count()", &queryOptions{}, &streamOptions{maxSize: 100},
+		func(call string, result json.RawMessage) {})
+	if err == nil || !strings.Contains(err.Error(), "no spill directory") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
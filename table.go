@@ -0,0 +1,272 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+)
+
+const tableColumnGap = "  "
+
+// renderTable renders the results of a query response as tables fitting in the terminal width.
+// The summaries of truncated bitmaps give their original cardinality.
+func renderTable(response *queryResponse, summaries []bitmapSummary) string {
+	width := screenWidth()
+	counts := map[int]int{}
+	for _, summary := range summaries {
+		counts[summary.result] = summary.count
+	}
+	buf := &bytes.Buffer{}
+	for i, result := range response.results {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		// results are numbered from 0 like in paths, e.g. _ .results[0]
+		title := result.call
+		if title == "" {
+			title = fmt.Sprintf("Result %d", i)
+		}
+		fmt.Fprintln(buf, colorString(attrBold, title))
+		count, ok := counts[i]
+		if !ok && result.bitmap != nil {
+			count = len(result.bitmap.Bits)
+		}
+		renderResultTable(buf, result, count, width)
+	}
+	if len(response.columnAttrs) > 0 {
+		buf.WriteString("\n")
+		fmt.Fprintln(buf, colorString(attrBold, "Column attributes"))
+		renderColumnAttrs(buf, response.columnAttrs, width)
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// renderValueTable renders a JSON value other than a query response, e.g. the response of :http,
+// see valueRows.
+func renderValueTable(value interface{}) (string, bool) {
+	headers, rows, ok := valueRows(value)
+	if !ok {
+		return "", false
+	}
+	width := screenWidth()
+	buf := &bytes.Buffer{}
+	renderRows(buf, headers, rows, make([]bool, len(headers)), width)
+	return strings.TrimRight(buf.String(), "\n"), true
+}
+
+// renderResultTable renders a result, count is the cardinality of a bitmap result.
+func renderResultTable(buf *bytes.Buffer, result *queryResult, count int, width int) {
+	switch result.kind {
+	case resultCount:
+		fmt.Fprintln(buf, formatThousands(result.count))
+	case resultChanged:
+		fmt.Fprintf(buf, "changed: %t\n", result.changed)
+	case resultTopN:
+		rows := make([][]string, len(result.pairs))
+		for i, pair := range result.pairs {
+			id := strconv.FormatUint(pair.ID, 10)
+			if pair.Key != "" {
+				id = pair.Key
+			}
+			rows[i] = []string{strconv.Itoa(i + 1), id, formatThousands(pair.Count)}
+		}
+		renderRows(buf, []string{"#", "ID", "Count"}, rows, []bool{true, true, true}, width)
+	case resultBitmap:
+		renderBits(buf, result.bitmap.Bits, count, width)
+		if len(result.bitmap.Attrs) > 0 {
+			renderAttrs(buf, result.bitmap.Attrs, width)
+		}
+	default:
+		fmt.Fprintln(buf, "ok")
+	}
+}
+
+// renderBits wraps the bits in columns and displays the total cardinality, which is count
+// since the bits may be truncated.
+func renderBits(buf *bytes.Buffer, bits []uint64, count int, width int) {
+	cellWidth := 1
+	for _, bit := range bits {
+		if n := len(strconv.FormatUint(bit, 10)); n > cellWidth {
+			cellWidth = n
+		}
+	}
+	perLine := (width + len(tableColumnGap)) / (cellWidth + len(tableColumnGap))
+	if perLine < 1 {
+		perLine = 1
+	}
+	for i, bit := range bits {
+		fmt.Fprintf(buf, "%*d", cellWidth, bit)
+		if (i+1)%perLine == 0 || i == len(bits)-1 {
+			buf.WriteString("\n")
+		} else {
+			buf.WriteString(tableColumnGap)
+		}
+	}
+	noun := "bits"
+	if count == 1 {
+		noun = "bit"
+	}
+	fmt.Fprintln(buf, colorString(attrDim, fmt.Sprintf("%s %s", formatThousands(uint64(count)), noun)))
+}
+
+func renderAttrs(buf *bytes.Buffer, attrs map[string]interface{}, width int) {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, len(keys))
+	for i, key := range keys {
+		rows[i] = []string{key, fmt.Sprint(attrs[key])}
+	}
+	renderRows(buf, []string{"Attribute", "Value"}, rows, []bool{false, false}, width)
+}
+
+func renderColumnAttrs(buf *bytes.Buffer, sets []columnAttrSet, width int) {
+	keySet := map[string]bool{}
+	for _, set := range sets {
+		for key := range set.Attrs {
+			keySet[key] = true
+		}
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	headers := append([]string{"ID"}, keys...)
+	rightAlign := make([]bool, len(headers))
+	rightAlign[0] = true
+	rows := make([][]string, len(sets))
+	for i, set := range sets {
+		row := []string{strconv.FormatUint(set.ID, 10)}
+		for _, key := range keys {
+			value := ""
+			if v, ok := set.Attrs[key]; ok {
+				value = fmt.Sprint(v)
+			}
+			row = append(row, value)
+		}
+		rows[i] = row
+	}
+	renderRows(buf, headers, rows, rightAlign, width)
+}
+
+// renderRows renders an aligned table. Columns are shrunk, starting from the widest,
+// until the table fits in width.
+func renderRows(buf *bytes.Buffer, headers []string, rows [][]string, rightAlign []bool, width int) {
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = utf8.RuneCountInString(header)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for {
+		total := len(tableColumnGap) * (len(widths) - 1)
+		widest := 0
+		for i, w := range widths {
+			total += w
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if total <= width || widths[widest] <= 4 {
+			break
+		}
+		widths[widest]--
+	}
+	writeRow := func(cells []string) {
+		parts := make([]string, len(cells))
+		for i, cell := range cells {
+			if utf8.RuneCountInString(cell) > widths[i] {
+				cell = string([]rune(cell)[:widths[i]-1]) + "…"
+			}
+			padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if rightAlign[i] {
+				parts[i] = padding + cell
+			} else {
+				parts[i] = cell + padding
+			}
+		}
+		fmt.Fprintln(buf, strings.TrimRight(strings.Join(parts, tableColumnGap), " "))
+	}
+	writeRow(headers)
+	separators := make([]string, len(widths))
+	for i, w := range widths {
+		separators[i] = strings.Repeat("─", w)
+	}
+	fmt.Fprintln(buf, colorString(attrDim, strings.Join(separators, tableColumnGap)))
+	for _, row := range rows {
+		writeRow(row)
+	}
+}
+
+// screenWidth returns the width of the terminal, or 80 if the output is not a terminal.
+func screenWidth() int {
+	width := readline.GetScreenWidth()
+	if width <= 0 {
+		return 80
+	}
+	return width
+}
+
+// formatThousands formats n with comma thousands separators, e.g. 12,345
+func formatThousands(n uint64) string {
+	text := strconv.FormatUint(n, 10)
+	if len(text) <= 3 {
+		return text
+	}
+	parts := []string{}
+	first := len(text) % 3
+	if first > 0 {
+		parts = append(parts, text[:first])
+	}
+	for i := first; i < len(text); i += 3 {
+		parts = append(parts, text[i:i+3])
+	}
+	return strings.Join(parts, ",")
+}
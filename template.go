@@ -0,0 +1,227 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+const configFileName = "config.json"
+
+type config struct {
+	Templates map[string]string `json:"templates"`
+}
+
+// templateResult is the data a template is executed against for each result.
+type templateResult struct {
+	Call    string
+	Type    string
+	Bits    []uint64
+	Attrs   map[string]interface{}
+	Count   uint64
+	Pairs   []pairResult
+	Changed bool
+}
+
+type templateResponse struct {
+	Results     []*templateResult
+	ColumnAttrs []columnAttrSet
+	// Result is the first result, which is the only one for most queries.
+	Result *templateResult
+}
+
+var templateColors = map[string]Ansi{
+	"black":   fgBlack,
+	"red":     fgRed,
+	"green":   fgGreen,
+	"yellow":  fgYellow,
+	"blue":    fgBlue,
+	"magenta": fgMagenta,
+	"cyan":    fgCyan,
+	"white":   fgWhite,
+	"bold":    attrBold,
+	"dim":     attrDim,
+}
+
+var templateFuncs = template.FuncMap{
+	"thousands": templateThousands,
+	"join":      templateJoin,
+	"truncate":  templateTruncate,
+	"color":     templateColor,
+}
+
+func loadConfig(homeDirectory string) (*config, error) {
+	cfg := &config{Templates: map[string]string{}}
+	if homeDirectory == "" {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadFile(path.Join(homeDirectory, configFileName))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid configuration file: %s", err)
+	}
+	return cfg, nil
+}
+
+// parseOutputTemplate parses a quoted template, or loads the named template from the configuration.
+func (c *Console) parseOutputTemplate(text string) (*template.Template, error) {
+	if len(text) >= 2 && (text[0] == '\'' || text[0] == '"') && text[len(text)-1] == text[0] {
+		text = text[1 : len(text)-1]
+	} else {
+		cfg, err := loadConfig(c.homeDirectory)
+		if err != nil {
+			return nil, err
+		}
+		named, ok := cfg.Templates[text]
+		if !ok {
+			return nil, fmt.Errorf("Template not found: %s. Quote the template or add it to %s",
+				text, path.Join(c.homeDirectory, configFileName))
+		}
+		text = named
+	}
+	return template.New("output").Funcs(templateFuncs).Parse(text)
+}
+
+// renderTemplate executes the template with the response, summaries describe the bitmaps truncated in it.
+func renderTemplate(tmpl *template.Template, response *decodedResponse, summaries []bitmapSummary) (string, error) {
+	var data interface{}
+	if response.decoded != nil {
+		data = newTemplateResponse(response.decoded, summaries)
+	} else if err := json.Unmarshal(response.body, &data); err != nil {
+		data = string(response.body)
+	}
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// newTemplateResponse returns the fields of the template, the count of a truncated bitmap is the count of all its bits.
+func newTemplateResponse(response *queryResponse, summaries []bitmapSummary) *templateResponse {
+	data := &templateResponse{
+		Results:     make([]*templateResult, len(response.results)),
+		ColumnAttrs: response.columnAttrs,
+	}
+	for i, result := range response.results {
+		r := &templateResult{
+			Call:    result.call,
+			Type:    result.kind.String(),
+			Count:   result.count,
+			Pairs:   result.pairs,
+			Changed: result.changed,
+		}
+		if result.bitmap != nil {
+			r.Bits = result.bitmap.Bits
+			r.Attrs = result.bitmap.Attrs
+			r.Count = uint64(len(result.bitmap.Bits))
+		}
+		data.Results[i] = r
+	}
+	for _, summary := range summaries {
+		data.Results[summary.result].Count = uint64(summary.count)
+	}
+	if len(data.Results) > 0 {
+		data.Result = data.Results[0]
+	}
+	return data
+}
+
+func templateThousands(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case uint64:
+		return formatThousands(v), nil
+	case int:
+		if v < 0 {
+			return "-" + formatThousands(uint64(-v)), nil
+		}
+		return formatThousands(uint64(v)), nil
+	case float64:
+		if v < 0 {
+			return "-" + formatThousands(uint64(-v)), nil
+		}
+		return formatThousands(uint64(v)), nil
+	}
+	return "", fmt.Errorf("thousands: unsupported value %v", value)
+}
+
+func templateJoin(bits []uint64, separator string) string {
+	parts := make([]string, len(bits))
+	for i, bit := range bits {
+		parts[i] = fmt.Sprint(bit)
+	}
+	return strings.Join(parts, separator)
+}
+
+// templateTruncate shortens a string to n characters or a bit list to n bits.
+func templateTruncate(n int, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if utf8.RuneCountInString(v) <= n {
+			return v, nil
+		}
+		return string([]rune(v)[:n]) + "…", nil
+	case []uint64:
+		if len(v) <= n {
+			return v, nil
+		}
+		return v[:n], nil
+	}
+	return nil, errors.New("truncate: unsupported value")
+}
+
+func templateColor(name string, value interface{}) (string, error) {
+	color, ok := templateColors[name]
+	if !ok {
+		return "", fmt.Errorf("color: unknown color %s", name)
+	}
+	return colorString(color, fmt.Sprint(value)), nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFormatTemplateKeepsSpacing(t *testing.T) {
+	c := &Console{}
+	line := ":format template '{{range .Results}}{{.Call}}:  {{.Count}}\t|{{end}}'"
+	err := c.executeFormatCommand(":format", strings.Fields(line)[1:], line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.format != formatTemplate {
+		t.Fatalf("format: %s", c.format)
+	}
+	got, err := renderTemplate(c.template, newDecodedResponse([]byte(`{"results": [3, 4]}`), "Count(Bitmap(frame=f, rowID=1)) Count(Bitmap(frame=f, rowID=2))"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Count:  3\t|Count:  4\t|"; got != expected {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestTemplateTruncatesBits(t *testing.T) {
+	c := newTestConsole(ioutil.Discard)
+	line := ":format template '{{join .Result.Bits \",\"}} of {{.Result.Count}}'"
+	if err := c.executeFormatCommand(":format", strings.Fields(line)[1:], line); err != nil {
+		t.Fatal(err)
+	}
+	c.bitLimit = 2
+	response := newDecodedResponse([]byte(`{"results":[{"attrs":{},"bits":[1,2,3,4,5]}]}`), "Bitmap(frame=f, rowID=1)")
+	lines := strings.Split(c.renderResponse(response), "\n")
+	if len(lines) != 2 || lines[0] != "1,2 of 5" || !strings.Contains(lines[1], "… 3 more (use _ full)") {
+		t.Fatalf("got %q", lines)
+	}
+	if got := c.renderResponseLimit(response, 0); got != "1,2,3,4,5 of 5" {
+		t.Fatalf("without a limit: got %q", got)
+	}
+}
+
+func TestFormatTemplateUsage(t *testing.T) {
+	c := &Console{}
+	err := c.executeFormatCommand(":format", []string{"template"}, ":format template")
+	if err == nil || !strings.HasPrefix(err.Error(), "usage:") {
+		t.Fatalf("expected the usage, got %v", err)
+	}
+}
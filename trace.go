@@ -0,0 +1,342 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+type traceLevel int
+
+const (
+	traceOff traceLevel = iota
+	traceOn
+	traceVerbose
+)
+
+type tracer struct {
+	// level is accessed atomically, since requests are traced from several goroutines.
+	level int32
+	out   io.Writer
+	file  *os.File
+	mu    sync.Mutex
+}
+
+// maxTracedBody is the number of bytes of a body displayed in verbose traces.
+const maxTracedBody = 64 * 1024
+
+func newTracer() *tracer {
+	return &tracer{
+		level: int32(traceOff),
+		out:   os.Stderr,
+	}
+}
+
+func (t *tracer) getLevel() traceLevel {
+	return traceLevel(atomic.LoadInt32(&t.level))
+}
+
+func (t *tracer) setLevel(level traceLevel) {
+	atomic.StoreInt32(&t.level, int32(level))
+}
+
+// setOutput directs the trace to the given file, or to stderr if path is empty.
+func (t *tracer) setOutput(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+	t.out = os.Stderr
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	t.file = f
+	t.out = f
+	return nil
+}
+
+func (t *tracer) close() {
+	t.setOutput("")
+}
+
+func (t *tracer) printf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.out, format, args...)
+}
+
+type tracingTransport struct {
+	transport http.RoundTripper
+	tracer    *tracer
+}
+
+// RoundTrip traces a request once its response body is read to the end or closed,
+// so streamed responses are not read into memory.
+func (tt *tracingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	level := tt.tracer.getLevel()
+	if level == traceOff {
+		return tt.transport.RoundTrip(request)
+	}
+	var requestBody []byte
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err == nil {
+			requestBody, _ = ioutil.ReadAll(body)
+			body.Close()
+		}
+	}
+	tic := time.Now()
+	response, err := tt.transport.RoundTrip(request)
+	if err != nil {
+		tt.tracer.printf("[trace] %s %s -> error: %s (%s)\n", request.Method, request.URL, err, time.Since(tic))
+		return nil, err
+	}
+	body := &tracedBody{
+		ReadCloser: response.Body,
+		keep:       level == traceVerbose,
+	}
+	body.done = func() {
+		tt.traceResponse(level, request, requestBody, response, body, time.Since(tic))
+	}
+	response.Body = body
+	return response, nil
+}
+
+func (tt *tracingTransport) traceResponse(level traceLevel, request *http.Request, requestBody []byte,
+	response *http.Response, body *tracedBody, elapsed time.Duration) {
+	responseBody := body.kept.Bytes()
+	responseSize := fmt.Sprintf("%d B", body.size)
+	if !body.complete {
+		responseSize += " (not read to the end)"
+	}
+	compressed := response.Header.Get("Content-Encoding") == "gzip"
+	if compressed {
+		responseSize = fmt.Sprintf("%d B gzip", body.size)
+		if body.complete && len(responseBody) == body.size {
+			if uncompressed, err := gunzipBytes(responseBody); err == nil {
+				responseSize = fmt.Sprintf("%d B gzip, %d B uncompressed", body.size, len(uncompressed))
+				responseBody = uncompressed
+				compressed = false
+			}
+		}
+	}
+	requestSize := fmt.Sprintf("%d B", len(requestBody))
+	if request.Header.Get("Content-Encoding") == "gzip" {
+		if uncompressed, err := gunzipBytes(requestBody); err == nil {
+			requestSize = fmt.Sprintf("%d B gzip, %d B uncompressed", len(requestBody), len(uncompressed))
+			requestBody = uncompressed
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "[trace] %s %s -> %s, %s, %s\n",
+		request.Method, request.URL, response.Status, responseSize, elapsed)
+	if level == traceVerbose {
+		fmt.Fprintln(buf, "> Request headers:")
+		writeHeaders(buf, request.Header)
+		if len(requestBody) > 0 {
+			fmt.Fprintf(buf, "> Request body (%s):\n%s\n", requestSize, truncateTracedBody(requestBody))
+		}
+		fmt.Fprintln(buf, "< Response headers:")
+		writeHeaders(buf, response.Header)
+		switch {
+		case compressed && body.size > 0:
+			fmt.Fprintf(buf, "< Response body (%s) is compressed and too large to display\n", responseSize)
+		case len(responseBody) > 0:
+			fmt.Fprintf(buf, "< Response body (%s):\n%s\n", responseSize, truncateTracedBody(responseBody))
+		}
+	}
+	tt.tracer.printf("%s", buf.String())
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (tt *tracingTransport) CloseIdleConnections() {
+	if transport, ok := tt.transport.(interface {
+		CloseIdleConnections()
+	}); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+// tracedBody counts the bytes read from a response body, keeping the first ones for verbose traces.
+type tracedBody struct {
+	io.ReadCloser
+	keep     bool
+	kept     bytes.Buffer
+	size     int
+	complete bool
+	done     func()
+	once     sync.Once
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += n
+	if b.keep && b.kept.Len() < maxTracedBody {
+		keep := n
+		if rest := maxTracedBody - b.kept.Len(); keep > rest {
+			keep = rest
+		}
+		b.kept.Write(p[:keep])
+	}
+	if err == io.EOF {
+		b.complete = true
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+func truncateTracedBody(body []byte) string {
+	if len(body) <= maxTracedBody {
+		return string(body)
+	}
+	return string(body[:maxTracedBody]) + "… (truncated)"
+}
+
+// tracingProxy forwards the requests of go-pilosa to the server through a tracing transport,
+// since go-pilosa creates its own HTTP transport. Requests are forwarded as they are,
+// the proxy adds no headers of its own.
+type tracingProxy struct {
+	uri       *pilosa.URI
+	target    *url.URL
+	server    *http.Server
+	transport *tracingTransport
+}
+
+func newTracingProxy(target *pilosa.URI, tracer *tracer) (*tracingProxy, error) {
+	targetURL, err := url.Parse(target.Normalize())
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	uri, err := pilosa.NewURIFromAddress("http://" + listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	proxy := &tracingProxy{
+		uri:    uri,
+		target: targetURL,
+		transport: &tracingTransport{
+			transport: newHTTPClient().Transport,
+			tracer:    tracer,
+		},
+	}
+	proxy.server = &http.Server{
+		Handler:  proxy,
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	go proxy.server.Serve(listener)
+	return proxy, nil
+}
+
+func (p *tracingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the body is read, so it can be traced; the requests of go-pilosa are small
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	target := *p.target
+	target.Path = r.URL.Path
+	target.RawPath = r.URL.RawPath
+	target.RawQuery = r.URL.RawQuery
+	request, err := http.NewRequest(r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	for key, values := range r.Header {
+		request.Header[key] = values
+	}
+	response, err := p.transport.RoundTrip(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+	for key, values := range response.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(response.StatusCode)
+	io.Copy(w, response.Body)
+}
+
+func (p *tracingProxy) close() {
+	p.server.Close()
+	p.transport.CloseIdleConnections()
+}
+
+func writeHeaders(w io.Writer, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(w, "    %s: %s\n", key, value)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[1]}`))
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	tracer := newTracer()
+	tracer.out = out
+	client := &http.Client{Transport: &tracingTransport{
+		transport: http.DefaultTransport,
+		tracer:    tracer,
+	}}
+
+	get := func() string {
+		response, err := client.Get(server.URL + "/version")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		return string(body)
+	}
+
+	if body := get(); body != `{"results":[1]}` || out.Len() != 0 {
+		t.Fatalf("trace off: body %q, trace %q", body, out.String())
+	}
+	tracer.setLevel(traceOn)
+	if body := get(); body != `{"results":[1]}` {
+		t.Fatalf("trace on: body %q", body)
+	}
+	if !strings.Contains(out.String(), "GET "+server.URL+"/version -> 200 OK, 15 B") {
+		t.Fatalf("trace on: unexpected trace %q", out.String())
+	}
+	out.Reset()
+	tracer.setLevel(traceVerbose)
+	get()
+	if !strings.Contains(out.String(), "< Response body (15 B):\n{\"results\":[1]}") {
+		t.Fatalf("trace verbose: unexpected trace %q", out.String())
+	}
+}
+
+func TestTracingProxy(t *testing.T) {
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"results":[1]}`))
+	}))
+	defer server.Close()
+	target, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	tracer := newTracer()
+	tracer.out = out
+	tracer.setLevel(traceVerbose)
+	proxy, err := newTracingProxy(target.URI, tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.close()
+
+	request, _ := http.NewRequest("POST", proxy.uri.Normalize()+"/index/i/query?slices=1", strings.NewReader("Count()"))
+	request.Header.Set("X-Test", "1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated || string(body) != `{"results":[1]}` {
+		t.Fatalf("unexpected response: %s %q", response.Status, body)
+	}
+	if received.URL.String() != "/index/i/query?slices=1" || string(receivedBody) != "Count()" {
+		t.Fatalf("unexpected request: %s %q", received.URL, receivedBody)
+	}
+	if received.Header.Get("X-Test") != "1" || received.Header.Get("X-Forwarded-For") != "" {
+		t.Fatalf("the headers should be forwarded unchanged: %v", received.Header)
+	}
+	if !strings.Contains(out.String(), "> Request body (7 B):\nCount()") {
+		t.Fatalf("the request body should be traced: %q", out.String())
+	}
+}
+
+func TestConnectionTracing(t *testing.T) {
+	server := newPilosaServer("1")
+	defer server.Close()
+	tracer := newTracer()
+	conn, err := newConnection("a", server.URL, tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.close()
+	if conn.proxy != nil {
+		t.Fatalf("the proxy should not run while tracing is off")
+	}
+	if err := conn.setTracing(true); err != nil || conn.proxy == nil {
+		t.Fatalf("the proxy should run while tracing is on: %v", err)
+	}
+	if err := conn.setTracing(false); err != nil || conn.proxy != nil {
+		t.Fatalf("the proxy should be stopped: %v", err)
+	}
+	tracer.setLevel(traceOn)
+	if err := conn.connect(); err != nil || conn.proxy == nil {
+		t.Fatalf("the proxy should be started on connect while tracing is on: %v", err)
+	}
+}
+
+func TestTruncateTracedBody(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), maxTracedBody)
+	if text := truncateTracedBody(body); text != string(body) {
+		t.Fatalf("a body of %d bytes should not be truncated", len(body))
+	}
+	body = append(body, 'y')
+	if text := truncateTracedBody(body); text != string(body[:maxTracedBody])+"… (truncated)" {
+		t.Fatalf("a body of %d bytes should be truncated", len(body))
+	}
+}
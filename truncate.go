@@ -0,0 +1,129 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// defaultBitLimit is the number of bits of a bitmap result displayed by default.
+const defaultBitLimit = 1000
+
+// bitmapSummary describes a bitmap result whose bits were not all displayed.
+type bitmapSummary struct {
+	result    int
+	displayed int
+	count     int
+	min       uint64
+	max       uint64
+}
+
+// truncateBitmaps limits the bits of each bitmap result of a query response to limit.
+// The response is returned unchanged if it is not a query response or no bitmap exceeds the limit,
+// otherwise a copy with the truncated results is returned.
+func truncateBitmaps(response *decodedResponse, limit int) (*decodedResponse, []bitmapSummary) {
+	if limit <= 0 || response.decoded == nil {
+		return response, nil
+	}
+	summaries := []bitmapSummary{}
+	results := make([]*queryResult, len(response.decoded.results))
+	for i, result := range response.decoded.results {
+		results[i] = result
+		if result.kind != resultBitmap || len(result.bitmap.Bits) <= limit {
+			continue
+		}
+		summaries = append(summaries, summarizeBitmap(i, result.bitmap.Bits, limit))
+		truncated := *result
+		truncated.bitmap = &bitmapResult{Attrs: result.bitmap.Attrs, Bits: result.bitmap.Bits[:limit]}
+		results[i] = &truncated
+	}
+	if len(summaries) == 0 {
+		return response, nil
+	}
+	return &decodedResponse{
+		query:   response.query,
+		decoded: &queryResponse{results: results, columnAttrs: response.decoded.columnAttrs},
+	}, summaries
+}
+
+func summarizeBitmap(result int, bits []uint64, limit int) bitmapSummary {
+	summary := bitmapSummary{
+		result:    result,
+		displayed: limit,
+		count:     len(bits),
+		min:       bits[0],
+		max:       bits[0],
+	}
+	for _, bit := range bits {
+		if bit < summary.min {
+			summary.min = bit
+		}
+		if bit > summary.max {
+			summary.max = bit
+		}
+	}
+	return summary
+}
+
+func (s bitmapSummary) String() string {
+	return fmt.Sprintf("… %s more (use _ full), %s bits in result %d, min column ID %d, max column ID %d",
+		formatThousands(uint64(s.count-s.displayed)), formatThousands(uint64(s.count)), s.result, s.min, s.max)
+}
+
+func (c *Console) executeBitLimitCommand(cmd string, args []string) error {
+	if len(args) == 0 {
+		if c.bitLimit <= 0 {
+			fmt.Fprintln(c.stdout, "Bit limit: off")
+		} else {
+			fmt.Fprintln(c.stdout, "Bit limit:", c.bitLimit)
+		}
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("usage: :bit-limit [count | off]")
+	}
+	if args[0] == "off" {
+		c.bitLimit = 0
+		return nil
+	}
+	limit, err := strconv.Atoi(args[0])
+	if err != nil || limit <= 0 {
+		return fmt.Errorf("Invalid bit limit: %s", args[0])
+	}
+	c.bitLimit = limit
+	return nil
+}
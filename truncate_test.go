@@ -0,0 +1,103 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTruncateBitmaps(t *testing.T) {
+	body := []byte(`{"results":[3,{"attrs":{"a":1},"bits":[5,1,9,3]}],"columnAttrs":[{"id":1,"attrs":{"b":2}}]}`)
+	query := "Count(Bitmap(frame=f, rowID=1)) Bitmap(frame=f, rowID=1)"
+	response := newDecodedResponse(body, query)
+	truncated, summaries := truncateBitmaps(response, 2)
+	expected := `{"results":[3,{"attrs":{"a":1},"bits":[5,1]}],"columnAttrs":[{"id":1,"attrs":{"b":2}}]}`
+	if string(truncated.jsonBody()) != expected {
+		t.Fatalf("got %s, expected %s", truncated.jsonBody(), expected)
+	}
+	if truncated.query != query || truncated.decoded.results[0] != response.decoded.results[0] {
+		t.Fatalf("the results which are not truncated should be kept: %+v", truncated)
+	}
+	if len(response.decoded.results[1].bitmap.Bits) != 4 || string(response.jsonBody()) != string(body) {
+		t.Fatalf("the response was changed: %s", response.jsonBody())
+	}
+	summary := bitmapSummary{result: 1, displayed: 2, count: 4, min: 1, max: 9}
+	if !reflect.DeepEqual(summaries, []bitmapSummary{summary}) {
+		t.Fatalf("summaries: %+v", summaries)
+	}
+	if got := summary.String(); got != "… 2 more (use _ full), 4 bits in result 1, min column ID 1, max column ID 9" {
+		t.Fatalf("summary: %s", got)
+	}
+}
+
+func TestTruncateBitmapsUnchanged(t *testing.T) {
+	tests := []struct {
+		body  string
+		limit int
+	}{
+		{`{"results":[{"attrs":{},"bits":[1,2,3]}]}`, 0},
+		{`{"results":[{"attrs":{},"bits":[1,2,3]}]}`, 3},
+		{`{"nodes":[{"bits":[1,2,3]}]}`, 1},
+		{`not json`, 1},
+	}
+	for _, test := range tests {
+		response := newDecodedResponse([]byte(test.body), "Bitmap(frame=f, rowID=1)")
+		truncated, summaries := truncateBitmaps(response, test.limit)
+		if truncated != response || len(summaries) != 0 {
+			t.Errorf("%s, %d: got %s, %v", test.body, test.limit, truncated.jsonBody(), summaries)
+		}
+	}
+}
+
+func TestRenderTableShowsOriginalCount(t *testing.T) {
+	body := []byte(`{"results":[{"attrs":{},"bits":[1,2,3,4,5]},{"attrs":{},"bits":[7]}]}`)
+	truncated, summaries := truncateBitmaps(newDecodedResponse(body, ""), 2)
+	text := formatResponse(formatTable, truncated, summaries)
+	lines := strings.Split(text, "\n")
+	expected := []string{
+		colorString(attrBold, "Result 0"),
+		"1  2",
+		colorString(attrDim, "5 bits"),
+		"",
+		colorString(attrBold, "Result 1"),
+		"7",
+		colorString(attrDim, "1 bit"),
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("got %q, expected %q", lines, expected)
+	}
+}
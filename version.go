@@ -0,0 +1,181 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type semver struct {
+	major int
+	minor int
+	patch int
+}
+
+// fieldsVersion is the first server version which uses fields, rows and shards
+// instead of frames, bitmaps and slices.
+var fieldsVersion = semver{1, 0, 0}
+
+type versionRange struct {
+	since semver
+	// until is the first version which does not support the feature; zero means no upper bound.
+	until semver
+}
+
+func (r versionRange) contains(v semver) bool {
+	if v.less(r.since) {
+		return false
+	}
+	return r.until == (semver{}) || v.less(r.until)
+}
+
+var pqlCalls = map[string]versionRange{
+	"Bitmap":         {until: fieldsVersion},
+	"Clear":          {since: fieldsVersion},
+	"ClearBit":       {until: fieldsVersion},
+	"Count":          {},
+	"Difference":     {},
+	"Intersect":      {},
+	"Range":          {},
+	"Row":            {since: fieldsVersion},
+	"Set":            {since: fieldsVersion},
+	"SetBit":         {until: fieldsVersion},
+	"SetColumnAttrs": {},
+	"SetRowAttrs":    {},
+	"TopN":           {},
+	"Union":          {},
+	"Xor":            {since: semver{0, 7, 0}},
+}
+
+// commands are the commands which only some server versions support.
+var commands = map[string]versionRange{
+	":check-consistency": {until: fieldsVersion},
+	":fragment":          {until: fieldsVersion},
+	":slices":            {until: fieldsVersion},
+}
+
+// parseSemver parses versions like v0.4.0 or 0.4.0-12-g1234abc.
+func parseSemver(version string) (semver, error) {
+	text := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(text, "-+"); i >= 0 {
+		text = text[:i]
+	}
+	parts := strings.Split(text, ".")
+	if len(parts) != 3 {
+		return semver{}, fmt.Errorf("Invalid version: %s", version)
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return semver{}, fmt.Errorf("Invalid version: %s", version)
+		}
+		numbers[i] = n
+	}
+	return semver{numbers[0], numbers[1], numbers[2]}, nil
+}
+
+func (v semver) less(other semver) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	if v.minor != other.minor {
+		return v.minor < other.minor
+	}
+	return v.patch < other.patch
+}
+
+func (v semver) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// supportedPQLCalls returns the PQL calls the server supports; all calls if the version is not known.
+func supportedPQLCalls(version *semver) []string {
+	calls := []string{}
+	for call, versions := range pqlCalls {
+		if version == nil || versions.contains(*version) {
+			calls = append(calls, call)
+		}
+	}
+	sort.Strings(calls)
+	return calls
+}
+
+// unsupportedPQLCalls returns the known PQL calls in the query which the server does not support.
+func unsupportedPQLCalls(version *semver, query string) []string {
+	calls := []string{}
+	if version == nil {
+		return calls
+	}
+	for _, call := range allCalls(query) {
+		versions, ok := pqlCalls[call]
+		if ok && !versions.contains(*version) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func checkCommandSupported(version *semver, cmd string) error {
+	if version == nil {
+		return nil
+	}
+	versions, ok := commands[cmd]
+	if ok && !versions.contains(*version) {
+		return fmt.Errorf("%s is not supported by Pilosa %s", cmd, version)
+	}
+	return nil
+}
+
+// checkSchemaTarget warns about creating frames on servers which use fields.
+func checkSchemaTarget(version *semver, which string, options map[string]string) {
+	if version == nil || version.less(fieldsVersion) {
+		return
+	}
+	if which == "frame" {
+		printWarning(fmt.Sprintf("Pilosa %s uses fields instead of frames", version))
+	}
+	for option := range options {
+		switch option {
+		case "inverse_enabled", "inverseEnabled", "inverse", "i",
+			"row_label", "rowLabel", "row", "r",
+			"column_label", "columnLabel", "col", "c":
+			printWarning(fmt.Sprintf("Option %s is not supported by Pilosa %s", option, version))
+		}
+	}
+}
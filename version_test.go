@@ -0,0 +1,143 @@
+/*
+Copyright 2017 Yuce Tekol
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+1. Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+
+2. Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+
+3. Neither the name of the copyright holder nor the names of its
+contributors may be used to endorse or promote products derived
+from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+DAMAGE.
+*/
+
+package picon
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		version string
+		semver  semver
+		err     bool
+	}{
+		{"v0.4.0", semver{0, 4, 0}, false},
+		{"0.7.1", semver{0, 7, 1}, false},
+		{"v1.0.0-12-g1234abc", semver{1, 0, 0}, false},
+		{"v1.2.3+dirty", semver{1, 2, 3}, false},
+		{"v0.4", semver{}, true},
+		{"v0.x.0", semver{}, true},
+		{"", semver{}, true},
+	}
+	for _, test := range tests {
+		v, err := parseSemver(test.version)
+		if (err != nil) != test.err {
+			t.Errorf("parseSemver(%q): unexpected error: %v", test.version, err)
+			continue
+		}
+		if v != test.semver {
+			t.Errorf("parseSemver(%q) = %s, want %s", test.version, v, test.semver)
+		}
+	}
+}
+
+func TestVersionRange(t *testing.T) {
+	tests := []struct {
+		versions versionRange
+		version  semver
+		contains bool
+	}{
+		{versionRange{}, semver{0, 1, 0}, true},
+		{versionRange{since: semver{0, 7, 0}}, semver{0, 6, 9}, false},
+		{versionRange{since: semver{0, 7, 0}}, semver{0, 7, 0}, true},
+		{versionRange{since: semver{0, 7, 0}}, semver{2, 0, 0}, true},
+		{versionRange{until: fieldsVersion}, semver{0, 9, 9}, true},
+		{versionRange{until: fieldsVersion}, fieldsVersion, false},
+		{versionRange{since: semver{0, 5, 0}, until: semver{0, 8, 0}}, semver{0, 8, 1}, false},
+	}
+	for _, test := range tests {
+		if contains := test.versions.contains(test.version); contains != test.contains {
+			t.Errorf("%v contains %s = %t, want %t", test.versions, test.version, contains, test.contains)
+		}
+	}
+}
+
+func TestUnsupportedPQLCalls(t *testing.T) {
+	old, fields := &semver{0, 4, 0}, &fieldsVersion
+	tests := []struct {
+		version *semver
+		query   string
+		calls   []string
+	}{
+		{nil, "Set(1, f=2)", []string{}},
+		{old, "Bitmap(frame=f, rowID=1)", []string{}},
+		{old, "Count(Row(f=1))", []string{"Row"}},
+		{old, "Xor(Bitmap(rowID=1), Bitmap(rowID=2))", []string{"Xor"}},
+		{fields, "Count(Bitmap(frame=f, rowID=1))", []string{"Bitmap"}},
+		{fields, "SetRowAttrs(f, 1, name=\"SetBit(1)\")", []string{}},
+		{old, "Bitmap(frame='Set(', rowID=1) SetBit(frame=f, rowID=1, columnID=2)", []string{}},
+	}
+	for _, test := range tests {
+		calls := unsupportedPQLCalls(test.version, test.query)
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("unsupportedPQLCalls(%v, %q) = %v, want %v", test.version, test.query, calls, test.calls)
+		}
+	}
+}
+
+func TestCheckCommandSupported(t *testing.T) {
+	tests := []struct {
+		version *semver
+		cmd     string
+		err     string
+	}{
+		{nil, ":slices", ""},
+		{&semver{0, 4, 0}, ":slices", ""},
+		{&fieldsVersion, ":slices", ":slices is not supported by Pilosa 1.0.0"},
+		{&fieldsVersion, ":check-consistency", ":check-consistency is not supported by Pilosa 1.0.0"},
+		{&fieldsVersion, ":status", ""},
+	}
+	for _, test := range tests {
+		err := checkCommandSupported(test.version, test.cmd)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("checkCommandSupported(%v, %q) = %v, want %q", test.version, test.cmd, err, test.err)
+		}
+	}
+}
+
+func TestListSupportedCommands(t *testing.T) {
+	c := newTestConsole(ioutil.Discard)
+	list := c.listSupportedCommands(":slices", ":fragment", ":status")
+	if commands := list(""); !reflect.DeepEqual(commands, []string{":slices", ":fragment", ":status"}) {
+		t.Fatalf("without a connection: got %v", commands)
+	}
+	c.conn = &connection{semver: &fieldsVersion}
+	if commands := list(""); !reflect.DeepEqual(commands, []string{":status"}) {
+		t.Fatalf("with Pilosa %s: got %v", fieldsVersion, commands)
+	}
+}